@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/bulon99/msgo"
 	msLog "github.com/bulon99/msgo/log"
 	"github.com/bulon99/msgo/mspool"
 	"github.com/bulon99/msgo/token"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"sync"
 	"time"
@@ -55,7 +58,7 @@ func main() {
 
 	g.Get("/hello", func(ctx *msgo.Context) {
 		fmt.Fprintln(ctx.W, "get bulon.com/user/hello")
-	}, M) //对该请求添加单独的中间件
+	}, M).Name("user.hello") //对该请求添加单独的中间件，并命名路由
 	g.Post("/hello", func(ctx *msgo.Context) {
 		ctx.Logger.Debug("debug日志")
 		ctx.Logger.WithFields(msLog.Fields{
@@ -76,7 +79,7 @@ func main() {
 		fmt.Fprintln(ctx.W, "any bulon.com/user/any")
 	})
 	g.Get("/get/:id", func(ctx *msgo.Context) {
-		fmt.Fprintln(ctx.W, ctx.R.RequestURI, "catched by /get/:id")
+		fmt.Fprintln(ctx.W, ctx.R.RequestURI, "catched by /get/:id", "id:", ctx.Param("id"))
 	})
 	g.Get("/hello/*/get", func(ctx *msgo.Context) {
 		fmt.Fprintln(ctx.W, ctx.R.RequestURI, "catched by /hello/*/get")
@@ -126,7 +129,8 @@ func main() {
 
 	//重定向
 	g.Get("/redirect", func(ctx *msgo.Context) {
-		ctx.Redirect(http.StatusFound, "/user/hello")
+		location, _ := engine.URL("user.hello") //根据路由名称生成URL
+		ctx.Redirect(http.StatusFound, location)
 	})
 
 	//返回text
@@ -189,6 +193,26 @@ func main() {
 		}
 	})
 
+	//将表单和文件绑定到结构体，并验证文件大小、个数和类型
+	type Upload struct {
+		Name  string                  `form:"name" validate:"required"`
+		File  *multipart.FileHeader   `form:"file" validate:"required,maxsize=2MB,mimetypes=image/png image/jpeg"`
+		Files []*multipart.FileHeader `form:"file0" validate:"max=5,maxsize=2MB"`
+	}
+	g.Post("/upload", func(ctx *msgo.Context) {
+		var upload Upload
+		if err := ctx.Bind(&upload); err != nil {
+			ctx.Fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		for _, fileHeader := range append(upload.Files, upload.File) {
+			if err := ctx.SaveUploadedFile(fileHeader, "upload/"+fileHeader.Filename); err != nil {
+				log.Println(err)
+			}
+		}
+		ctx.JSON(http.StatusOK, upload.Name)
+	})
+
 	//json参数
 	g.Post("/jsonParam", func(ctx *msgo.Context) {
 		//user := User{}
@@ -216,6 +240,17 @@ func main() {
 
 	//协程池
 	p, _ := mspool.NewPool(5)
+	engine.OnShutdown(func(ctx context.Context) error { //关闭服务时释放协程池
+		p.Release()
+		return nil
+	})
+	g.Get("/async", func(ctx *msgo.Context) {
+		cp := ctx.Copy() //处理函数返回后Context会被复用，协程中使用副本
+		p.Submit(func() {
+			log.Println("异步处理", cp.R.URL.Path, cp.GetQuery("id"))
+		})
+		ctx.JSON(http.StatusOK, "submitted")
+	})
 	g.Post("/pool", func(ctx *msgo.Context) {
 		currentTime := time.Now().UnixMilli()
 		var wg sync.WaitGroup
@@ -291,10 +326,34 @@ func main() {
 		ctx.JSON(http.StatusOK, token)
 	})
 
+	//双向认证，只有提供了key/ca.crt签发的客户端证书才能访问
+	//curl --cacert key/ca.crt --cert key/client.pem --key key/client.key https://127.0.0.1:8118/user/cert
+	certAuth := &msgo.CertAuth{}
+	g.Get("/cert", func(ctx *msgo.Context) {
+		cert := ctx.ClientCert()
+		ctx.JSON(http.StatusOK, map[string]any{"subject": cert.Subject.String(), "dns": cert.DNSNames})
+	}, certAuth.Auth)
+
 	//预加载模板
 	//engine.SetFuncMap()
 	engine.LoadTemplate("tpl/*html")
 	//启动服务
 	//engine.Run("localhost:8111")
-	engine.RunTLS("localhost:8118", "key/server.pem", "key/server.key") //https://127.0.0.1:8118/user/hello 必须通过https访问
+	engine.ServerConfig = msgo.ServerConfig{
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+	err := engine.Graceful(func() error { //https://127.0.0.1:8118/user/hello 必须通过https访问
+		return engine.RunTLSWithConfig("localhost:8118", msgo.TLSConfig{
+			CertFile:       "key/server.pem",
+			KeyFile:        "key/server.key",
+			ClientCAFile:   "key/ca.crt",
+			ClientAuth:     tls.VerifyClientCertIfGiven, //不提供客户端证书也可以访问其他接口
+			ReloadInterval: time.Minute,                 //更换证书文件后不需要重启
+		})
+	}, 10*time.Second) //Ctrl+C后等待请求处理完成再退出
+	if err != nil {
+		log.Fatal(err)
+	}
 }
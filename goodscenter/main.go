@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"github.com/bulon99/goodscenter/api"
+	"github.com/bulon99/msgo"
 	"github.com/bulon99/msgo/rpc"
 	trace "github.com/bulon99/msgo/tracer"
 	"google.golang.org/grpc"
 	"log"
+	"net/http"
+	"time"
 )
 
 func main() {
@@ -35,10 +39,27 @@ func main() {
 	//err := server.Run()
 	//log.Println(err)
 
-	server, _ := rpc.NewGrpcServer("localhost:9002", trace.ServerOption()) //添加链路追踪拦截器
+	//server, _ := rpc.NewGrpcServer("localhost:9002", trace.ServerOption()) //添加链路追踪拦截器
+	//server.Register(func(g *grpc.Server) {
+	//	api.RegisterGoodsApiServer(g, &api.GoodsRpcServices{})
+	//}, "", "", 0, "")
+	//err := server.Run()
+	//log.Println(err)
+
+	//HTTP和gRPC共用9002端口
+	engine := msgo.Default()
+	engine.Group("goods").Get("/health", func(ctx *msgo.Context) {
+		ctx.JSON(http.StatusOK, "ok")
+	})
+	server := rpc.NewSharedGrpcServer(trace.ServerOption()) //添加链路追踪拦截器
 	server.Register(func(g *grpc.Server) {
 		api.RegisterGoodsApiServer(g, &api.GoodsRpcServices{})
 	}, "", "", 0, "")
-	err := server.Run()
+	engine.Grpc(server)
+	engine.OnShutdown(func(ctx context.Context) error {
+		server.Stop()
+		return nil
+	})
+	err := engine.RunGraceful("localhost:9002", 10*time.Second)
 	log.Println(err)
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/bulon99/msgo"
 	"github.com/bulon99/msgo/gateway"
+	"log"
 	"net/http"
 )
 
@@ -30,5 +31,7 @@ func main() {
 		ServiceName: "goodsCenter",
 	})
 	engine.SetGatewayConfig(configs)
-	engine.Run("127.0.0.1:80") //通过80端口转发
+	if err := engine.Run("127.0.0.1:80"); err != nil { //通过80端口转发
+		log.Fatal(err)
+	}
 }
@@ -33,12 +33,13 @@ func (a *Accounts) BasicAuth(next HandlerFunc) HandlerFunc {
 	}
 }
 
-func (a *Accounts) UnAuthHandlers(ctx *Context) { //若验证失败，使用该方法处理
+func (a *Accounts) UnAuthHandlers(ctx *Context) { //若验证失败，使用该方法处理，处理后中止请求
 	if a.UnAuthHandler != nil {
 		a.UnAuthHandler(ctx)
+		ctx.Abort()
 	} else { //未设置该方法，返回401
 		ctx.W.Header().Set("WWW-Authenticate", a.Realm) //Digest认证
-		ctx.W.WriteHeader(http.StatusUnauthorized)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
 	}
 }
 
@@ -7,5 +7,33 @@ type Binding interface {
 	Bind(*http.Request, any) error
 }
 
+//路由参数不在请求中，单独传入
+type URIBinding interface {
+	Name() string
+	BindUri(map[string][]string, any) error
+}
+
 var JSON = jsonBinding{}
 var XML = xmlBinding{}
+var Query = queryBinding{}
+var Form = formBinding{}
+var FormMultipart = formMultipartBinding{}
+var Header = headerBinding{}
+var URI = uriBinding{}
+
+//根据请求方法和Content-Type选择绑定方式，GET请求使用Form
+func Default(method, contentType string) Binding {
+	if method == http.MethodGet {
+		return Form
+	}
+	switch contentType {
+	case "application/json":
+		return JSON
+	case "application/xml", "text/xml":
+		return XML
+	case "multipart/form-data":
+		return FormMultipart
+	default: //application/x-www-form-urlencoded
+		return Form
+	}
+}
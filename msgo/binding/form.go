@@ -0,0 +1,42 @@
+package binding
+
+import (
+	"errors"
+	"net/http"
+)
+
+const defaultMemory = 32 << 20
+
+type formBinding struct{}
+type formMultipartBinding struct{}
+
+func (formBinding) Name() string {
+	return "form"
+}
+
+//映射query参数和表单(包括multipart表单)中的数据，使用form标签
+//multipart表单中的文件映射到*multipart.FileHeader和[]*multipart.FileHeader类型的字段
+func (formBinding) Bind(r *http.Request, obj any) error {
+	if err := r.ParseMultipartForm(defaultMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return err
+	}
+	if err := mapping(obj, newFormSource(r, r.Form), "form"); err != nil {
+		return err
+	}
+	return validate(obj)
+}
+
+func (formMultipartBinding) Name() string {
+	return "multipart/form-data"
+}
+
+//只映射multipart表单中的数据和文件，使用form标签
+func (formMultipartBinding) Bind(r *http.Request, obj any) error {
+	if err := r.ParseMultipartForm(defaultMemory); err != nil {
+		return err
+	}
+	if err := mapping(obj, newFormSource(r, r.MultipartForm.Value), "form"); err != nil {
+		return err
+	}
+	return validate(obj)
+}
@@ -0,0 +1,227 @@
+package binding
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//映射的数据来源，如query参数、表单、请求头、路由参数
+type source interface {
+	get(key string) ([]string, bool)
+}
+
+type formSource map[string][]string
+
+func (s formSource) get(key string) ([]string, bool) {
+	values, ok := s[key]
+	return values, ok
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+//将数据按结构体标签映射到obj的字段上，tags中靠前的标签优先，都没有时使用字段名
+//字段类型支持字符串、布尔、整数、浮点数、time.Time(time_format标签指定格式，默认RFC3339)、
+//time.Duration、实现了encoding.TextUnmarshaler的类型，以及它们的指针、切片和数组
+func mapping(obj any, src source, tags ...string) error {
+	value := reflect.ValueOf(obj)
+	if value.Kind() != reflect.Pointer || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return errors.New("binding: obj must be a non-nil pointer to a struct")
+	}
+	return mapStruct(value.Elem(), src, tags)
+}
+
+func mapStruct(value reflect.Value, src source, tags []string) error {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		name, tagged := fieldName(field, tags)
+		if name == "-" {
+			continue
+		}
+		fieldValue := value.Field(i)
+		if !tagged && field.Type.Kind() == reflect.Struct && field.Type != timeType { //未设置标签的结构体字段，映射其中的字段
+			if err := mapStruct(fieldValue, src, tags); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if isFileField(field.Type) {
+			setFiles(fieldValue, src, name)
+			continue
+		}
+		values, ok := src.get(name)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if err := setField(fieldValue, field, values); err != nil {
+			return fmt.Errorf("binding: field %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func fieldName(field reflect.StructField, tags []string) (string, bool) {
+	for _, tag := range tags {
+		if name, ok := field.Tag.Lookup(tag); ok {
+			name, _, _ = strings.Cut(name, ",")
+			if name != "" {
+				return name, true
+			}
+		}
+	}
+	return field.Name, false
+}
+
+func setField(value reflect.Value, field reflect.StructField, values []string) error {
+	if value.Type() != timeType && value.CanAddr() && reflect.PointerTo(value.Type()).Implements(textUnmarshalerType) {
+		return setValue(value, field, values[0])
+	}
+	switch value.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(value.Type().Elem())
+		if err := setField(elem.Elem(), field, values); err != nil {
+			return err
+		}
+		value.Set(elem)
+		return nil
+	case reflect.Slice:
+		slice := reflect.MakeSlice(value.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setValue(slice.Index(i), field, s); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+		return nil
+	case reflect.Array:
+		if len(values) != value.Len() {
+			return fmt.Errorf("%q is not valid value for %s", values, value.Type())
+		}
+		for i, s := range values {
+			if err := setValue(value.Index(i), field, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return setValue(value, field, values[0])
+}
+
+//将字符串转换为字段的类型，空字符串设置为零值
+func setValue(value reflect.Value, field reflect.StructField, s string) error {
+	switch value.Type() {
+	case timeType:
+		return setTime(value, field, s)
+	case durationType:
+		if s == "" {
+			s = "0"
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+	if value.Kind() == reflect.Pointer {
+		elem := reflect.New(value.Type().Elem())
+		if err := setValue(elem.Elem(), field, s); err != nil {
+			return err
+		}
+		value.Set(elem)
+		return nil
+	}
+	if value.CanAddr() && reflect.PointerTo(value.Type()).Implements(textUnmarshalerType) {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(s)
+	case reflect.Bool:
+		if s == "" {
+			s = "false"
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			s = "0"
+		}
+		n, err := strconv.ParseInt(s, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			s = "0"
+		}
+		n, err := strconv.ParseUint(s, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			s = "0"
+		}
+		f, err := strconv.ParseFloat(s, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+//time_format可以是time.Parse的格式，或者unix、unixmilli表示时间戳
+func setTime(value reflect.Value, field reflect.StructField, s string) error {
+	if s == "" {
+		value.Set(reflect.ValueOf(time.Time{}))
+		return nil
+	}
+	format := field.Tag.Get("time_format")
+	var t time.Time
+	switch format {
+	case "unix", "unixmilli":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		if format == "unix" {
+			t = time.Unix(n, 0)
+		} else {
+			t = time.UnixMilli(n)
+		}
+	default:
+		if format == "" {
+			format = time.RFC3339
+		}
+		var err error
+		if t, err = time.ParseInLocation(format, s, time.Local); err != nil {
+			return err
+		}
+	}
+	value.Set(reflect.ValueOf(t))
+	return nil
+}
@@ -0,0 +1,27 @@
+package binding
+
+import (
+	"net/http"
+	"net/textproto"
+)
+
+type headerBinding struct{}
+
+type headerSource http.Header
+
+func (s headerSource) get(key string) ([]string, bool) { //请求头名称不区分大小写
+	values, ok := s[textproto.CanonicalMIMEHeaderKey(key)]
+	return values, ok
+}
+
+func (headerBinding) Name() string {
+	return "header"
+}
+
+//映射请求头，使用header标签
+func (headerBinding) Bind(r *http.Request, obj any) error {
+	if err := mapping(obj, headerSource(r.Header), "header"); err != nil {
+		return err
+	}
+	return validate(obj)
+}
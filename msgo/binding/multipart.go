@@ -0,0 +1,153 @@
+package binding
+
+import (
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+//multipart表单中的文件
+type fileSource interface {
+	getFiles(key string) ([]*multipart.FileHeader, bool)
+}
+
+type multipartSource struct {
+	formSource
+	files map[string][]*multipart.FileHeader
+}
+
+func (s multipartSource) getFiles(key string) ([]*multipart.FileHeader, bool) {
+	files, ok := s.files[key]
+	return files, ok
+}
+
+func newFormSource(r *http.Request, values map[string][]string) source {
+	if r.MultipartForm == nil {
+		return formSource(values)
+	}
+	return multipartSource{formSource: values, files: r.MultipartForm.File}
+}
+
+func isFileField(t reflect.Type) bool {
+	return t == fileHeaderType || t == fileHeadersType
+}
+
+//*multipart.FileHeader取第一个文件，[]*multipart.FileHeader取全部文件
+func setFiles(value reflect.Value, src source, name string) {
+	files, ok := src.(fileSource)
+	if !ok {
+		return
+	}
+	headers, ok := files.getFiles(name)
+	if !ok || len(headers) == 0 {
+		return
+	}
+	if value.Type() == fileHeaderType {
+		value.Set(reflect.ValueOf(headers[0]))
+	} else {
+		value.Set(reflect.ValueOf(headers))
+	}
+}
+
+//文件相关的验证标签，单个文件和文件切片都可以使用，文件个数使用min、max：
+//maxsize=2MB 每个文件的最大大小，单位可以是B、KB、MB、GB
+//mimetypes=image/png image/jpeg 允许的文件类型，根据文件内容判断而不是客户端传的Content-Type，支持image/*
+func registerFileValidations(v *validator.Validate) {
+	//结构体类型的字段不会执行自定义的验证，将文件转换为切片后验证
+	v.RegisterCustomTypeFunc(func(field reflect.Value) any {
+		if field.CanAddr() {
+			return []*multipart.FileHeader{field.Addr().Interface().(*multipart.FileHeader)}
+		}
+		header := field.Interface().(multipart.FileHeader)
+		return []*multipart.FileHeader{&header}
+	}, multipart.FileHeader{})
+	_ = v.RegisterValidation("maxsize", validateMaxSize)
+	_ = v.RegisterValidation("mimetypes", validateMimeTypes)
+}
+
+func fileHeaders(fl validator.FieldLevel) []*multipart.FileHeader {
+	headers, ok := fl.Field().Interface().([]*multipart.FileHeader)
+	if !ok {
+		panic(fmt.Sprintf("Bad field type %T", fl.Field().Interface()))
+	}
+	return headers
+}
+
+func validateMaxSize(fl validator.FieldLevel) bool {
+	limit, err := parseSize(fl.Param())
+	if err != nil {
+		panic(err)
+	}
+	for _, header := range fileHeaders(fl) {
+		if header.Size > limit {
+			return false
+		}
+	}
+	return true
+}
+
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	s = strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("binding: invalid size %q", s)
+	}
+	return n * unit, nil
+}
+
+func validateMimeTypes(fl validator.FieldLevel) bool {
+	allowed := strings.Fields(fl.Param())
+	for _, header := range fileHeaders(fl) {
+		mimeType, err := sniffMimeType(header)
+		if err != nil || !matchMimeType(mimeType, allowed) {
+			return false
+		}
+	}
+	return true
+}
+
+//读取文件开头的512字节判断文件类型
+func sniffMimeType(header *multipart.FileHeader) (string, error) {
+	f, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	mimeType, _, _ := strings.Cut(http.DetectContentType(buf[:n]), ";")
+	return mimeType, nil
+}
+
+func matchMimeType(mimeType string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == mimeType || (strings.HasSuffix(a, "/*") && strings.HasPrefix(mimeType, a[:len(a)-1])) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,17 @@
+package binding
+
+import "net/http"
+
+type queryBinding struct{}
+
+func (queryBinding) Name() string {
+	return "query"
+}
+
+//映射query参数，使用query标签，没有query标签时使用form标签
+func (queryBinding) Bind(r *http.Request, obj any) error {
+	if err := mapping(obj, formSource(r.URL.Query()), "query", "form"); err != nil {
+		return err
+	}
+	return validate(obj)
+}
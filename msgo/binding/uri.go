@@ -0,0 +1,15 @@
+package binding
+
+type uriBinding struct{}
+
+func (uriBinding) Name() string {
+	return "uri"
+}
+
+//映射路由参数，使用uri标签，如 /user/:id 对应 uri:"id"
+func (uriBinding) BindUri(params map[string][]string, obj any) error {
+	if err := mapping(obj, formSource(params), "uri"); err != nil {
+		return err
+	}
+	return validate(obj)
+}
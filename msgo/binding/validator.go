@@ -86,6 +86,7 @@ func (d *defaultValidator) validateStruct(obj any) error {
 func (d *defaultValidator) lazyInit() {
 	d.one.Do(func() {
 		d.validate = validator.New() //验证的时候，每次都需要使用validator.New()，会极大的浪费性能，可以使用单例来做优化
+		registerFileValidations(d.validate)
 	})
 }
 
@@ -1,6 +1,7 @@
 package msgo
 
 import (
+	"context"
 	"errors"
 	"github.com/bulon99/msgo/binding"
 	msLog "github.com/bulon99/msgo/log"
@@ -12,25 +13,130 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
+	"time"
 	"unicode"
 )
 
 const defaultMaxMemory int64 = 32 << 20
 
 type Context struct { //封装上下文
-	W                     http.ResponseWriter
+	W                     ResponseWriter
+	writer                responseWriter //W默认指向writer，随Context复用
 	R                     *http.Request
 	engine                *Engine
 	queryCache            url.Values
 	formCache             url.Values
 	DisallowUnknownFields bool
 	IsValidate            bool
-	StatusCode            int
+	StatusCode            int //Render等方法设置的状态码，实际发送的状态码为W.Status()
 	Logger                *msLog.Logger
 	Keys                  map[string]any //用于在上下文之间传值
+	params                Params         //路由参数
+	aborted               bool           //已中止，后续的中间件和处理函数不再执行
+	Errors                []error        //处理请求过程中记录的错误
 	mu                    sync.RWMutex
 	sameSite              http.SameSite
+	fixedPath             string //重定向到修正后的路径时的目标路径
+}
+
+//从池中取出Context时重置所有字段，避免上一个请求的数据泄漏到当前请求
+func (c *Context) reset(w http.ResponseWriter, r *http.Request) {
+	c.writer.reset(w)
+	c.W = &c.writer
+	c.R = r
+	c.queryCache = nil
+	c.formCache = nil
+	c.DisallowUnknownFields = false
+	c.IsValidate = false
+	c.StatusCode = 0
+	c.Logger = c.engine.Logger
+	c.Keys = nil
+	if size := c.engine.maxParams + c.engine.maxHostParams; cap(c.params) < size { //Context创建后又注册了参数更多的路由
+		c.params = make(Params, 0, size)
+	}
+	c.params = c.params[:0]
+	c.aborted = false
+	c.Errors = c.Errors[:0]
+	c.sameSite = http.SameSiteDefaultMode
+	c.fixedPath = ""
+}
+
+//返回当前Context的副本，用于在处理函数返回后仍需使用Context的协程，如提交给mspool.Pool的任务
+//原Context在请求结束后会被复用，不能在其他协程中使用；副本只读，写入响应返回错误
+//副本作为context.Context使用时仍随原请求结束而取消
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		R:                     c.R,
+		engine:                c.engine,
+		queryCache:            c.queryCache,
+		formCache:             c.formCache,
+		DisallowUnknownFields: c.DisallowUnknownFields,
+		IsValidate:            c.IsValidate,
+		StatusCode:            c.StatusCode,
+		Logger:                c.Logger,
+		params:                append(Params(nil), c.params...),
+		aborted:               c.aborted,
+		Errors:                append([]error(nil), c.Errors...),
+		sameSite:              c.sameSite,
+	}
+	cp.writer = responseWriter{
+		ResponseWriter: detachedResponseWriter{header: c.W.Header().Clone()},
+		status:         c.writer.status,
+		size:           c.writer.size,
+	}
+	cp.W = &cp.writer
+	c.mu.RLock()
+	if c.Keys != nil {
+		cp.Keys = make(map[string]any, len(c.Keys))
+		for k, v := range c.Keys {
+			cp.Keys[k] = v
+		}
+	}
+	c.mu.RUnlock()
+	return cp
+}
+
+var _ context.Context = (*Context)(nil)
+
+//Context实现了context.Context，可以直接传给gRPC、数据库等调用
+//Deadline、Done、Err使用请求的context，客户端断开连接或请求超时时Done关闭
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	if c.R == nil {
+		return
+	}
+	return c.R.Context().Deadline()
+}
+
+func (c *Context) Done() <-chan struct{} {
+	if c.R == nil {
+		return nil
+	}
+	return c.R.Context().Done()
+}
+
+func (c *Context) Err() error {
+	if c.R == nil {
+		return nil
+	}
+	return c.R.Context().Err()
+}
+
+//string类型的key先从Keys中查找，找不到时从请求的context中查找
+func (c *Context) Value(key any) any {
+	if key == (contextKey{}) {
+		return c
+	}
+	if k, ok := key.(string); ok {
+		if value, exists := c.Get(k); exists {
+			return value
+		}
+	}
+	if c.R == nil {
+		return nil
+	}
+	return c.R.Context().Value(key)
 }
 
 func (c *Context) GetHeader(key string) string {
@@ -81,6 +187,37 @@ func (c *Context) Get(key string) (value any, exists bool) {
 	return
 }
 
+//中止相关
+//中止请求，后续的中间件和处理函数不再执行，已经在执行的外层中间件可以通过IsAborted判断
+func (c *Context) Abort() {
+	c.aborted = true
+}
+
+func (c *Context) IsAborted() bool {
+	return c.aborted
+}
+
+func (c *Context) AbortWithStatus(code int) { //写入状态码并中止
+	c.StatusCode = code
+	c.W.WriteHeader(code)
+	c.Abort()
+}
+
+func (c *Context) AbortWithError(code int, err error) error { //记录错误，写入状态码并中止，返回传入的err
+	c.Errors = append(c.Errors, err)
+	c.AbortWithStatus(code)
+	return err
+}
+
+//路由参数相关
+func (c *Context) Param(key string) string { //获取路由参数，/get/:id 使用 Param("id")，** 匹配的剩余路径使用 Param("**")
+	return c.params.ByName(key)
+}
+
+func (c *Context) Params() Params { //获取全部路由参数
+	return c.params
+}
+
 func (c *Context) SetBasicAuth(username, password string) {
 	c.R.Header.Set("Authorization", "Basic "+BasicAuth(username, password))
 }
@@ -106,6 +243,9 @@ func (c *Context) GetQueryArray(key string) (values []string, ok bool) { //获
 }
 
 func (c *Context) initQueryCache() {
+	if c.queryCache != nil {
+		return
+	}
 	if c.R != nil {
 		c.queryCache = c.R.URL.Query()
 	} else {
@@ -129,7 +269,9 @@ func (c *Context) GetPostFormArray(key string) (values []string, ok bool) {
 }
 
 func (c *Context) initFormCache() {
-	c.formCache = make(url.Values)
+	if c.formCache != nil {
+		return
+	}
 	req := c.R
 	if err := req.ParseMultipartForm(defaultMaxMemory); err != nil {
 		if !errors.Is(err, http.ErrNotMultipart) { //http.ErrNotMultipart表示传表单时未传文件，忽略
@@ -223,10 +365,9 @@ func (c *Context) Template(name string, data any) error {
 }
 
 func (c *Context) Render(statusCode int, r render.Render) error {
-	err := r.Render(c.W)
 	c.StatusCode = statusCode
-	//c.W.WriteHeader(statusCode) 去掉不然会导致后面w.Header().Set()失效
-	return err
+	c.W.WriteHeader(statusCode) //W在写入响应体时才发送响应头，渲染时仍可设置Content-Type
+	return r.Render(c.W)
 }
 
 //json
@@ -294,10 +435,65 @@ func (c *Context) FileFromFS(filepath string, fs http.FileSystem) {
 
 //处理json参数
 func (c *Context) BindJson(obj any) error {
+	return c.MustBindWith(obj, c.jsonBinding())
+}
+
+func (c *Context) jsonBinding() binding.Binding {
 	jsonBinding := binding.JSON
 	jsonBinding.DisallowUnknownFields = c.DisallowUnknownFields
 	jsonBinding.IsValidate = c.IsValidate
-	return c.MustBindWith(obj, jsonBinding)
+	return jsonBinding
+}
+
+//请求的Content-Type，不包含charset等参数
+func (c *Context) ContentType() string {
+	contentType, _, _ := strings.Cut(c.GetHeader("Content-Type"), ";")
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+//根据请求方法和Content-Type选择绑定方式：GET请求和表单使用Form，json使用JSON，xml使用XML，
+//multipart/form-data使用FormMultipart
+func (c *Context) Bind(obj any) error {
+	return c.MustBindWith(obj, c.defaultBinding())
+}
+
+func (c *Context) ShouldBind(obj any) error {
+	return c.ShouldBindWith(obj, c.defaultBinding())
+}
+
+func (c *Context) defaultBinding() binding.Binding {
+	b := binding.Default(c.R.Method, c.ContentType())
+	if b == binding.JSON {
+		return c.jsonBinding()
+	}
+	return b
+}
+
+//处理query参数，使用query或form标签
+func (c *Context) BindQuery(obj any) error {
+	return c.MustBindWith(obj, binding.Query)
+}
+
+//处理请求头，使用header标签
+func (c *Context) BindHeader(obj any) error {
+	return c.MustBindWith(obj, binding.Header)
+}
+
+//处理路由参数，使用uri标签
+func (c *Context) BindUri(obj any) error {
+	if err := c.ShouldBindUri(obj); err != nil {
+		c.W.WriteHeader(http.StatusBadRequest)
+		return err
+	}
+	return nil
+}
+
+func (c *Context) ShouldBindUri(obj any) error {
+	params := make(map[string][]string, len(c.params))
+	for _, param := range c.params {
+		params[param.Key] = []string{param.Value}
+	}
+	return binding.URI.BindUri(params, obj)
 }
 
 //处理xml参数
@@ -319,5 +515,5 @@ func (c *Context) ShouldBindWith(obj any, b binding.Binding) error {
 }
 
 func (c *Context) Fail(code int, msg string) {
-	c.String(code, msg) //使用text格式返回错误数据
+	c.Render(code, render.String{Format: msg}) //使用text格式返回错误数据
 }
@@ -0,0 +1,34 @@
+package msgo
+
+import (
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net/http"
+	"strings"
+)
+
+//与gRPC服务共用端口，HTTP/2且content-type为application/grpc的请求交给handler处理，如rpc.MsGrpcServer
+//明文时通过h2c支持HTTP/2，https时使用标准库自带的HTTP/2
+//h2c连接不受Shutdown管理，需要通过OnShutdown注册gRPC服务的关闭函数
+//必须在Run等启动服务的方法之前调用，已启动的服务不会开启h2c
+func (e *Engine) Grpc(handler http.Handler) {
+	s := &e.serverState
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.servers) > 0 {
+		panic("服务已启动，必须在启动服务之前设置gRPC服务")
+	}
+	e.grpcHandler = handler
+}
+
+func isGrpcRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+//http.Server使用的Handler，开启gRPC时支持h2c
+func (e *Engine) serverHandler() http.Handler {
+	if e.grpcHandler == nil {
+		return e
+	}
+	return h2c.NewHandler(e, &http2.Server{IdleTimeout: e.ServerConfig.IdleTimeout})
+}
@@ -0,0 +1,103 @@
+package msgo
+
+import (
+	"fmt"
+	"strings"
+)
+
+//虚拟主机路由，同一个引擎上按Host请求头区分不同站点
+type hostRouter struct {
+	host   string   //如 api.example.com、*.tenant.example.com、:tenant.example.com
+	labels []string //按.拆分后的host，* 匹配任意一级，:name 匹配任意一级并记录到Params
+	exact  bool     //不包含 * 和 :参数，优先匹配
+	router *router
+}
+
+//返回只匹配该主机的路由，其路由组只处理Host请求头与之匹配的请求
+//host中的 * 匹配任意一级子域名，:name 匹配任意一级子域名并可通过ctx.Param(name)获取
+func (e *Engine) Host(host string) *router {
+	host = strings.ToLower(host)
+	for _, h := range e.hosts {
+		if h.host == host {
+			return h.router
+		}
+	}
+	h := &hostRouter{host: host, labels: strings.Split(host, "."), exact: true}
+	params := 0
+	for _, label := range h.labels {
+		switch {
+		case label == "" || label == ":":
+			panic(fmt.Sprintf("主机 %s 格式错误", host))
+		case label == "*":
+			h.exact = false
+		case label[0] == ':':
+			h.exact = false
+			params++
+		}
+	}
+	if params > e.maxHostParams {
+		e.maxHostParams = params
+	}
+	h.router = newRouter(e, host, e.router.names)
+	e.hosts = append(e.hosts, h)
+	return h.router
+}
+
+//根据Host请求头选择路由，主机参数追加到params中，未匹配时返回默认路由
+func (e *Engine) matchHost(host string, params *Params) *router {
+	if len(e.hosts) == 0 {
+		return e.router
+	}
+	host = stripHostPort(host)
+	for _, h := range e.hosts {
+		if h.exact && strings.EqualFold(h.host, host) {
+			return h.router
+		}
+	}
+	for _, h := range e.hosts {
+		if !h.exact && h.match(host, params) {
+			return h.router
+		}
+	}
+	return e.router
+}
+
+func (h *hostRouter) match(host string, params *Params) bool {
+	n := len(*params)
+	for i, label := range h.labels {
+		end := strings.IndexByte(host, '.')
+		if i == len(h.labels)-1 {
+			if end >= 0 {
+				break
+			}
+			end = len(host)
+		} else if end < 0 {
+			break
+		}
+		value := host[:end]
+		switch {
+		case value == "":
+			*params = (*params)[:n]
+			return false
+		case label == "*":
+		case label[0] == ':':
+			*params = append(*params, Param{Key: label[1:], Value: value})
+		case !strings.EqualFold(label, value):
+			*params = (*params)[:n]
+			return false
+		}
+		if i == len(h.labels)-1 {
+			return true
+		}
+		host = host[end+1:]
+	}
+	*params = (*params)[:n]
+	return false
+}
+
+func stripHostPort(host string) string { //去掉端口和末尾的.
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	return strings.TrimSuffix(host, ".")
+}
@@ -12,11 +12,12 @@ func Limiter(limit, cap int) MiddlewareFunc {
 	li := rate.NewLimiter(rate.Limit(limit), cap)
 	return func(next HandlerFunc) HandlerFunc {
 		return func(ctx *Context) {
-			con, cancel := context.WithTimeout(context.Background(), time.Second)
+			con, cancel := context.WithTimeout(ctx, time.Second) //客户端断开连接时不再等待
 			defer cancel()
 			err := li.WaitN(con, 1)
 			if err != nil {
-				ctx.String(http.StatusForbidden, "限流了")
+				ctx.Abort()
+				ctx.Fail(http.StatusForbidden, "限流了")
 				return
 			}
 			next(ctx)
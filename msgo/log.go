@@ -44,7 +44,8 @@ type LogFormatterParams struct {
 	ClientIP       net.IP
 	Method         string
 	Path           string
-	IsDisplayColor bool //控制是否展示彩色日志
+	IsDisplayColor bool   //控制是否展示彩色日志
+	ErrorMessage   string //ctx.Errors中记录的错误
 }
 
 func (p *LogFormatterParams) StatusCodeColor() string {
@@ -70,19 +71,21 @@ var defaultLogFormatter = func(params LogFormatterParams) string { //默认日
 		params.Latency = params.Latency.Truncate(time.Second)
 	}
 	if params.IsDisplayColor {
-		return fmt.Sprintf(" %s[msgo]%s  %s%v%s | %s%3d%s | %s%13v%s | %15s | %s%-7s%s %s%#v%s\n",
+		return fmt.Sprintf(" %s[msgo]%s  %s%v%s | %s%3d%s | %s%13v%s | %15s | %s%-7s%s %s%#v%s\n%s",
 			yellow, resetColor, blue, params.TimeStamp.Format("2006/01/02 15:04:05"), resetColor,
 			statusCodeColor, params.StatusCode, resetColor,
 			red, params.Latency, resetColor,
 			params.ClientIP,
 			magenta, params.Method, resetColor,
 			cyan, params.Path, resetColor,
+			params.ErrorMessage,
 		)
 	}
-	return fmt.Sprintf(" [msgo]  %v | %3d | %13v | %15s | %-7s %#v\n", //-7表示左对齐占7个位置，不加-则是右对齐
+	return fmt.Sprintf(" [msgo]  %v | %3d | %13v | %15s | %-7s %#v\n%s", //-7表示左对齐占7个位置，不加-则是右对齐
 		params.TimeStamp.Format("2006/01/02 15:04:05"),
 		params.StatusCode,
 		params.Latency, params.ClientIP, params.Method, params.Path,
+		params.ErrorMessage,
 	)
 }
 
@@ -110,7 +113,7 @@ func LoggerWithConfig(conf LoggerConfig, next HandlerFunc) HandlerFunc {
 		ip, _, _ := net.SplitHostPort(strings.TrimSpace(ctx.R.RemoteAddr))
 		clientIP := net.ParseIP(ip)
 		method := ctx.R.Method
-		statusCode := ctx.StatusCode
+		statusCode := ctx.W.Status()
 
 		if raw != "" {
 			path = path + "?" + raw
@@ -122,6 +125,9 @@ func LoggerWithConfig(conf LoggerConfig, next HandlerFunc) HandlerFunc {
 		param.StatusCode = statusCode
 		param.Method = method
 		param.Path = path
+		for _, err := range ctx.Errors { //请求被中止时记录的错误
+			param.ErrorMessage += fmt.Sprintf("Error: %v\n", err)
+		}
 		fmt.Fprint(conf.Out, conf.Formatter(param))
 	}
 }
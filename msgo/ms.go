@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strings"
 	"sync"
 )
 
@@ -20,81 +21,210 @@ type HandlerFunc func(ctx *Context)
 //中间件函数，传入一个HandlerFunc，在这个HandlerFunc前或者后加上要实现的代码作为新的HandlerFunc返回，从而实现前或者后中间件
 type MiddlewareFunc func(handleFunc HandlerFunc) HandlerFunc
 
+//将中间件组合到处理函数上，middlewares中靠前的在外层，先执行
+//请求被中止后，即使中间件调用了next，内层的中间件和处理函数也不再执行
+func chain(h HandlerFunc, middlewares []MiddlewareFunc) HandlerFunc {
+	h = abortable(h)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = abortable(middlewares[i](h))
+	}
+	return h
+}
+
+func abortable(h HandlerFunc) HandlerFunc {
+	return func(ctx *Context) {
+		if ctx.IsAborted() {
+			return
+		}
+		h(ctx)
+	}
+}
+
 //路由组
 type routerGroup struct {
-	name               string
-	handlerFuncMap     map[string]map[string]HandlerFunc      //map["/index"]map["GET"]HandlerFunc
-	middlewaresFuncMap map[string]map[string][]MiddlewareFunc //map["/index"]map["GET"][]MiddlewareFunc
-	treeNode           *treeNode
-	middlewares        []MiddlewareFunc //组中间件
+	prefix      string //完整的路径前缀，包含父路由组的名称
+	parent      *routerGroup
+	middlewares []MiddlewareFunc //组中间件
+	router      *router
 }
 
-func (r *routerGroup) Use(middlewareFunc ...MiddlewareFunc) { //添加中间件
+func (r *routerGroup) Use(middlewareFunc ...MiddlewareFunc) { //添加中间件，必须在引擎开始处理请求之前调用
+	r.router.engine.checkNotCompiled("添加中间件")
 	r.middlewares = append(r.middlewares, middlewareFunc...)
 }
 
-func (r *routerGroup) methodHandle(name string, method string, h HandlerFunc, ctx *Context) {
-	//组中间件
-	if r.middlewares != nil {
-		for _, middlewareFunc := range r.middlewares {
-			h = middlewareFunc(h)
-		}
-	}
-	//路由方法级别的中间件
-	middlewareFuncs := r.middlewaresFuncMap[name][method]
-	if middlewareFuncs != nil {
-		for _, middlewareFunc := range middlewareFuncs {
-			h = middlewareFunc(h)
-		}
+//创建子路由组，路径前缀为父路由组前缀加上name，父路由组的中间件对子路由组同样生效
+func (r *routerGroup) Group(name string) *routerGroup {
+	return &routerGroup{
+		prefix: joinPaths(r.prefix, name),
+		parent: r,
+		router: r.router,
 	}
-	h(ctx)
 }
 
-func (r *routerGroup) handle(name string, method string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) {
-	_, ok := r.handlerFuncMap[name]
-	if !ok {
-		r.handlerFuncMap[name] = make(map[string]HandlerFunc)
-		r.middlewaresFuncMap[name] = make(map[string][]MiddlewareFunc)
+//注册路由，返回的路由可以通过Name设置名称
+func (r *routerGroup) handle(name string, method string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) *Route {
+	path := joinPaths(r.prefix, name)
+	rt := &Route{
+		method:      method,
+		path:        path,
+		group:       r,
+		handlerFunc: handlerFunc,
+		middlewares: middlewareFunc,
 	}
-	_, ok = r.handlerFuncMap[name][method]
-	if ok {
-		panic("路由重复")
+	r.router.addRoute(path, method, rt)
+	return rt
+}
+
+func (r *routerGroup) Handle(method string, name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) *Route { //注册任意请求方法
+	if method == "" {
+		panic("请求方法不能为空")
 	}
-	r.handlerFuncMap[name][method] = handlerFunc
-	r.middlewaresFuncMap[name][method] = append(r.middlewaresFuncMap[name][method], middlewareFunc...)
-	r.treeNode.Put(name)
+	return r.handle(name, strings.ToUpper(method), handlerFunc, middlewareFunc...)
+}
+
+func (r *routerGroup) Any(name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) *Route {
+	return r.handle(name, ANY, handlerFunc, middlewareFunc...)
 }
 
-func (r *routerGroup) Any(name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) {
-	r.handle(name, ANY, handlerFunc, middlewareFunc...)
+func (r *routerGroup) Get(name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) *Route {
+	return r.handle(name, http.MethodGet, handlerFunc, middlewareFunc...)
 }
 
-func (r *routerGroup) Get(name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) {
-	r.handle(name, http.MethodGet, handlerFunc, middlewareFunc...)
+func (r *routerGroup) Post(name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) *Route {
+	return r.handle(name, http.MethodPost, handlerFunc, middlewareFunc...)
 }
 
-func (r *routerGroup) Post(name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) {
-	r.handle(name, http.MethodPost, handlerFunc, middlewareFunc...)
+func (r *routerGroup) Put(name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) *Route {
+	return r.handle(name, http.MethodPut, handlerFunc, middlewareFunc...)
 }
 
-//其他方法head put patch Delete
+func (r *routerGroup) Patch(name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) *Route {
+	return r.handle(name, http.MethodPatch, handlerFunc, middlewareFunc...)
+}
+
+func (r *routerGroup) Delete(name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) *Route {
+	return r.handle(name, http.MethodDelete, handlerFunc, middlewareFunc...)
+}
+
+//未注册HEAD时，HEAD请求会使用GET的处理函数，并且不返回响应体
+func (r *routerGroup) Head(name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) *Route {
+	return r.handle(name, http.MethodHead, handlerFunc, middlewareFunc...)
+}
+
+//未注册OPTIONS时，OPTIONS请求会自动返回包含已注册方法的Allow响应头
+func (r *routerGroup) Options(name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) *Route {
+	return r.handle(name, http.MethodOptions, handlerFunc, middlewareFunc...)
+}
+
+func (r *routerGroup) Connect(name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) *Route {
+	return r.handle(name, http.MethodConnect, handlerFunc, middlewareFunc...)
+}
+
+func (r *routerGroup) Trace(name string, handlerFunc HandlerFunc, middlewareFunc ...MiddlewareFunc) *Route {
+	return r.handle(name, http.MethodTrace, handlerFunc, middlewareFunc...)
+}
+
+var allowMethods = []string{ //Allow响应头中方法的顺序
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+func (r *router) allow(name string) string { //路由已注册的方法，用于Allow响应头
+	handlers := r.routerMap[name]
+	if _, ok := handlers[ANY]; ok {
+		return strings.Join(allowMethods, ", ")
+	}
+	methods := make([]string, 0, len(allowMethods))
+	for _, method := range allowMethods {
+		_, ok := handlers[method]
+		switch method {
+		case http.MethodHead:
+			_, get := handlers[http.MethodGet]
+			ok = ok || get
+		case http.MethodOptions:
+			ok = true
+		}
+		if ok {
+			methods = append(methods, method)
+		}
+	}
+	return strings.Join(methods, ", ")
+}
+
+//注册的路由
+type Route struct {
+	name        string //路由名称，可选
+	method      string
+	path        string
+	group       *routerGroup
+	handlerFunc HandlerFunc
+	middlewares []MiddlewareFunc //路由方法级别的中间件
+	handler     HandlerFunc      //组合了全部中间件的处理函数，引擎开始处理请求时生成
+}
+
+//路由生效的全部中间件，依次为引擎中间件、路由组中间件(父路由组在前)、路由方法级别的中间件
+func (r *Route) middlewareChain() []MiddlewareFunc {
+	var groups []*routerGroup
+	for g := r.group; g != nil; g = g.parent {
+		groups = append(groups, g)
+	}
+	middlewares := append([]MiddlewareFunc{}, r.group.router.engine.Middles...)
+	for i := len(groups) - 1; i >= 0; i-- {
+		middlewares = append(middlewares, groups[i].middlewares...)
+	}
+	return append(middlewares, r.middlewares...)
+}
+
+func (r *Route) compile() {
+	r.handler = chain(r.handlerFunc, r.middlewareChain())
+}
 
 //路由
 type router struct {
-	groups []*routerGroup
-	engine *Engine
+	host      string //虚拟主机，默认路由为空
+	engine    *Engine
+	treeNode  *treeNode
+	routerMap map[string]map[string]*Route //map["/user/index"]map["GET"]*Route
+	routes    []*Route                     //按注册顺序保存的路由
+	names     map[string]*Route            //命名路由，用于反向生成URL
+}
+
+func newRouter(engine *Engine, host string, names map[string]*Route) *router {
+	return &router{
+		host:      host,
+		engine:    engine,
+		treeNode:  &treeNode{},
+		routerMap: make(map[string]map[string]*Route),
+		names:     names,
+	}
 }
 
 func (r *router) Group(name string) *routerGroup {
-	g := &routerGroup{
-		name:               name,
-		handlerFuncMap:     make(map[string]map[string]HandlerFunc),
-		middlewaresFuncMap: make(map[string]map[string][]MiddlewareFunc),
-		treeNode:           &treeNode{name: "/", children: make([]*treeNode, 0)},
+	return &routerGroup{
+		prefix: joinPaths("/", name),
+		router: r,
+	}
+}
+
+func (r *router) addRoute(path string, method string, rt *Route) {
+	_, ok := r.routerMap[path]
+	if !ok {
+		r.routerMap[path] = make(map[string]*Route)
+	}
+	_, ok = r.routerMap[path][method]
+	if ok {
+		panic("路由重复")
+	}
+	r.engine.checkNotCompiled("注册路由")            //处理请求时会并发读取路由树，不能再修改
+	if err := r.treeNode.Put(path); err != nil { //启动时检测路由冲突，避免路由被静默遮蔽
+		panic(err)
+	}
+	if n := countParams(path); n > r.engine.maxParams {
+		r.engine.maxParams = n
 	}
-	g.Use(r.engine.Middles...)
-	r.groups = append(r.groups, g)
-	return g
+	r.routerMap[path][method] = rt
+	r.routes = append(r.routes, rt)
 }
 
 //引擎
@@ -109,14 +239,36 @@ type Engine struct {
 	OpenGateway      bool               //是否开启网关
 	gatewayTreeNode  *gateway.TreeNode
 	gatewayConfigMap map[string]gateway.GWConfig
+	maxParams        int           //路由中参数个数的最大值，用于预分配Context中的Params
+	hosts            []*hostRouter //虚拟主机路由，按注册顺序匹配，未匹配的主机使用默认路由
+	maxHostParams    int           //主机中参数个数的最大值
+	noRoute          HandlerFunc   //未匹配到路由时的处理函数
+	noMethod         HandlerFunc   //路由匹配但请求方法不匹配时的处理函数
+	Debug            bool          //调试模式，启动时打印路由表
+	compileOnce      sync.Once
+	compiled         bool        //中间件链已生成，之后不能再添加中间件
+	noRouteHandler   HandlerFunc //组合了引擎中间件的noRoute
+	noMethodHandler  HandlerFunc //组合了引擎中间件的noMethod
+	optionsHandler   HandlerFunc //组合了引擎中间件的自动OPTIONS响应
+	redirectHandler  HandlerFunc //组合了引擎中间件的修正路径重定向
+	//未匹配到路由时，若去掉或加上末尾的/能匹配，重定向到该路径
+	RedirectTrailingSlash bool
+	//未匹配到路由时，清理 .. 和重复的/ 并忽略大小写查找路由，找到则重定向到该路径
+	RedirectFixedPath bool
+	ServerConfig      ServerConfig //Run等方法创建http.Server时使用的配置
+	serverState       serverState
+	grpcHandler       http.Handler //共用端口的gRPC服务
 }
 
 func New() *Engine {
 	engine := &Engine{
-		router:           &router{},
 		gatewayTreeNode:  &gateway.TreeNode{Name: "/", Children: make([]*gateway.TreeNode, 0)},
 		gatewayConfigMap: make(map[string]gateway.GWConfig),
+		noRoute:          defaultNoRoute,
+		noMethod:         defaultNoMethod,
 	}
+	engine.router = newRouter(engine, "", make(map[string]*Route))
+	engine.SetFuncMap(nil)
 	engine.pool.New = func() any {
 		return engine.allocateContext()
 	}
@@ -127,20 +279,82 @@ func Default() *Engine {
 	engine := New()
 	engine.Logger = msLog.Default()
 	engine.Use(Logging, Recovery)
-	engine.router.engine = engine
 	return engine
 }
 
+//设置未匹配到路由时的处理函数，和引擎中间件一起执行，必须在引擎开始处理请求之前调用
+func (e *Engine) NoRoute(handlerFunc HandlerFunc) {
+	e.checkNotCompiled("设置NoRoute")
+	e.noRoute = handlerFunc
+}
+
+//设置请求方法不匹配时的处理函数，和引擎中间件一起执行，执行前已设置Allow响应头，必须在引擎开始处理请求之前调用
+func (e *Engine) NoMethod(handlerFunc HandlerFunc) {
+	e.checkNotCompiled("设置NoMethod")
+	e.noMethod = handlerFunc
+}
+
+func defaultNoRoute(ctx *Context) {
+	ctx.Render(http.StatusNotFound, render.String{Format: "%s not found\n", Data: []any{ctx.R.RequestURI}})
+}
+
+func defaultNoMethod(ctx *Context) {
+	ctx.Render(http.StatusMethodNotAllowed, render.String{Format: "%s %s not allowed \n", Data: []any{ctx.R.RequestURI, ctx.R.Method}})
+}
+
+func optionsResponse(ctx *Context) {
+	ctx.W.WriteHeader(http.StatusNoContent)
+}
+
+//重定向到ctx.fixedPath，GET请求使用301，其他请求使用308以保留请求方法和请求体
+func redirectToFixedPath(ctx *Context) {
+	code := http.StatusPermanentRedirect
+	if ctx.R.Method == http.MethodGet || ctx.R.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	location := ctx.fixedPath
+	if ctx.R.URL.RawQuery != "" {
+		location += "?" + ctx.R.URL.RawQuery
+	}
+	ctx.Redirect(code, location)
+}
+
+//为全部路由生成组合了中间件的处理函数，只在第一次处理请求时执行一次
+func (e *Engine) compile() {
+	for _, rt := range e.router.routes {
+		rt.compile()
+	}
+	for _, h := range e.hosts {
+		for _, rt := range h.router.routes {
+			rt.compile()
+		}
+	}
+	e.noRouteHandler = chain(e.noRoute, e.Middles)
+	e.noMethodHandler = chain(e.noMethod, e.Middles)
+	e.optionsHandler = chain(optionsResponse, e.Middles)
+	e.redirectHandler = chain(redirectToFixedPath, e.Middles)
+	e.compiled = true
+}
+
+//中间件链生成后再修改中间件、路由和处理函数不会生效，且与正在处理的请求并发读写，直接报错
+func (e *Engine) checkNotCompiled(action string) {
+	if e.compiled {
+		panic("引擎已开始处理请求，不能再" + action)
+	}
+}
+
 func (e *Engine) Handler() http.Handler { //返回本身
 	return e
 }
 
+//添加引擎中间件，对所有路由(包括之前创建的路由组)生效，必须在引擎开始处理请求之前调用
 func (e *Engine) Use(middles ...MiddlewareFunc) {
+	e.checkNotCompiled("添加中间件")
 	e.Middles = append(e.Middles, middles...)
 }
 
 func (e *Engine) allocateContext() any {
-	return &Context{engine: e}
+	return &Context{engine: e, params: make(Params, 0, e.maxParams+e.maxHostParams)}
 }
 
 func (e *Engine) SetGatewayConfig(configs []gateway.GWConfig) {
@@ -152,8 +366,11 @@ func (e *Engine) SetGatewayConfig(configs []gateway.GWConfig) {
 	}
 }
 
-func (e *Engine) SetFuncMap(funcMap template.FuncMap) { //设置模板函数映射
-	e.funcMap = funcMap
+func (e *Engine) SetFuncMap(funcMap template.FuncMap) { //设置模板函数映射，默认包含根据路由名称生成URL的url函数
+	e.funcMap = template.FuncMap{"url": e.URL}
+	for name, fn := range funcMap {
+		e.funcMap[name] = fn
+	}
 }
 
 func (e *Engine) LoadTemplate(pattern string) { //加载模板
@@ -168,15 +385,19 @@ func (e *Engine) SetHtmlTemplate(t *template.Template) {
 }
 
 func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if e.grpcHandler != nil && isGrpcRequest(r) {
+		e.grpcHandler.ServeHTTP(w, r)
+		return
+	}
+	e.compileOnce.Do(e.compile)
 	ctx := e.pool.Get().(*Context)
-	ctx.W = w
-	ctx.R = r
-	ctx.Logger = e.Logger
-	e.httpRequestHandle(ctx, w, r)
+	ctx.reset(w, r)
+	e.httpRequestHandle(ctx, r)
+	ctx.writer.WriteHeaderNow() //只设置了状态码没有写入响应体时发送响应头
 	e.pool.Put(ctx)
 }
 
-func (e *Engine) httpRequestHandle(ctx *Context, w http.ResponseWriter, r *http.Request) {
+func (e *Engine) httpRequestHandle(ctx *Context, r *http.Request) {
 	if e.OpenGateway { //已开启路由网关
 		//请求过来具体转发到哪
 		path := r.URL.Path
@@ -212,47 +433,77 @@ func (e *Engine) httpRequestHandle(ctx *Context, w http.ResponseWriter, r *http.
 			log.Println("错误处理")
 		}
 		proxy := httputil.ReverseProxy{Director: director, ModifyResponse: response, ErrorHandler: handler}
-		proxy.ServeHTTP(w, r)
+		proxy.ServeHTTP(ctx.W, r)
 		return
 	}
 	method := r.Method
-	for _, group := range e.router.groups {
-		routerName := SubStringLast(r.URL.Path, "/"+group.name) //r.URL.Path与r.RequestURI区别在于后者会包含query参数（如果有）
-		node := group.treeNode.Get(routerName)
-		if node != nil && node.isEnd {
-			//路由匹配上了
-			handle, ok := group.handlerFuncMap[node.routerName][ANY]
-			if ok {
-				group.methodHandle(node.routerName, ANY, handle, ctx)
-				return
-			}
-			handle, ok = group.handlerFuncMap[node.routerName][method]
+	path := cleanPath(r.URL.Path) //r.URL.Path与r.RequestURI区别在于后者会包含query参数（如果有），清理其中的 .. 和重复的/
+	router := e.matchHost(r.Host, &ctx.params)
+	if path != r.URL.Path && e.RedirectFixedPath { //清理后的路径能匹配到路由时才重定向，否则继续匹配并返回404
+		if router.treeNode.has(path) {
+			e.redirectFixedPath(ctx, path)
+			return
+		}
+		if fixedPath, ok := router.treeNode.findCaseInsensitivePath(path, e.RedirectTrailingSlash); ok {
+			e.redirectFixedPath(ctx, fixedPath)
+			return
+		}
+	}
+	node, pattern := router.treeNode.Get(path, &ctx.params)
+	if node != nil {
+		//路由匹配上了
+		routes := router.routerMap[pattern]
+		rt, ok := routes[ANY]
+		if ok {
+			rt.handler(ctx)
+			return
+		}
+		rt, ok = routes[method]
+		if ok {
+			rt.handler(ctx)
+			return
+		}
+		if method == http.MethodHead { //HEAD使用GET的处理函数，丢弃响应体
+			rt, ok = routes[http.MethodGet]
 			if ok {
-				group.methodHandle(node.routerName, method, handle, ctx)
+				ctx.writer.discardBody = true
+				rt.handler(ctx)
 				return
 			}
-			//路径匹配方法不匹配，显示405
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			fmt.Fprintf(w, "%s %s not allowed \n", r.RequestURI, method)
+		}
+		ctx.W.Header().Set("Allow", router.allow(pattern))
+		if method == http.MethodOptions { //自动响应OPTIONS
+			e.optionsHandler(ctx)
 			return
 		}
+		//路径匹配方法不匹配，显示405
+		e.noMethodHandler(ctx)
+		return
 	}
-	//当所有路由组中都未匹配到路径返回404
-	w.WriteHeader(http.StatusNotFound)
-	fmt.Fprintf(w, "%s not found\n", r.RequestURI)
-}
-
-func (e *Engine) Run(addr string) {
-	http.Handle("/", e)
-	err := http.ListenAndServe(addr, nil)
-	if err != nil {
-		log.Fatal(err)
+	if method != http.MethodConnect && path != "/" {
+		if e.RedirectTrailingSlash {
+			fixedPath := path + "/"
+			if strings.HasSuffix(path, "/") {
+				fixedPath = path[:len(path)-1]
+			}
+			if router.treeNode.has(fixedPath) {
+				e.redirectFixedPath(ctx, fixedPath)
+				return
+			}
+		}
+		if e.RedirectFixedPath {
+			if fixedPath, ok := router.treeNode.findCaseInsensitivePath(path, e.RedirectTrailingSlash); ok {
+				e.redirectFixedPath(ctx, fixedPath)
+				return
+			}
+		}
 	}
+	//未匹配到路径返回404
+	e.noRouteHandler(ctx)
 }
 
-func (e *Engine) RunTLS(addr, certFile, keyFile string) { //https支持
-	err := http.ListenAndServeTLS(addr, certFile, keyFile, e.Handler())
-	if err != nil {
-		log.Fatal(err)
-	}
+//经过引擎中间件重定向到修正后的路径
+func (e *Engine) redirectFixedPath(ctx *Context, fixedPath string) {
+	ctx.fixedPath = fixedPath
+	e.redirectHandler(ctx)
 }
@@ -0,0 +1,1081 @@
+package msgo
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/bulon99/msgo/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"html/template"
+	"io"
+	"log"
+	"math/big"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func serve(engine *Engine, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestHeadOptionsAllow(t *testing.T) { //HEAD回退到GET，OPTIONS和405返回Allow
+	engine := New()
+	g := engine.Group("user")
+	g.Get("/hello", func(ctx *Context) {
+		ctx.W.Header().Set("X-Hello", "1")
+		ctx.W.Write([]byte("hello"))
+	})
+	g.Delete("/hello", func(ctx *Context) {})
+
+	w := serve(engine, http.MethodHead, "/user/hello")
+	if w.Code != http.StatusOK || w.Header().Get("X-Hello") != "1" || w.Body.Len() != 0 {
+		t.Errorf("HEAD = %d %q %q", w.Code, w.Header().Get("X-Hello"), w.Body.String())
+	}
+	w = serve(engine, http.MethodOptions, "/user/hello")
+	if w.Code != http.StatusNoContent || w.Header().Get("Allow") != "GET, HEAD, DELETE, OPTIONS" {
+		t.Errorf("OPTIONS = %d %q", w.Code, w.Header().Get("Allow"))
+	}
+	w = serve(engine, http.MethodPost, "/user/hello")
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD, DELETE, OPTIONS" {
+		t.Errorf("POST = %d %q", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestNestedGroup(t *testing.T) { //子路由组继承前缀和中间件，只按真实的路径前缀匹配
+	engine := New()
+	var trace []string
+	mark := func(name string) MiddlewareFunc {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx *Context) {
+				trace = append(trace, name)
+				next(ctx)
+			}
+		}
+	}
+	api := engine.Group("api")
+	api.Use(mark("api"))
+	v1 := api.Group("v1")
+	v1.Use(mark("v1"))
+	v1.Get("/orders", func(ctx *Context) { ctx.W.Write([]byte("v1")) })
+	api.Group("/v2/").Get("/orders", func(ctx *Context) { ctx.W.Write([]byte("v2")) })
+	engine.Group("user").Get("/info", func(ctx *Context) {})
+
+	if w := serve(engine, http.MethodGet, "/api/v1/orders"); w.Body.String() != "v1" {
+		t.Errorf("/api/v1/orders = %q", w.Body.String())
+	}
+	if len(trace) != 2 || trace[0] != "api" || trace[1] != "v1" {
+		t.Errorf("middleware order = %v", trace)
+	}
+	if w := serve(engine, http.MethodGet, "/api/v2/orders"); w.Body.String() != "v2" {
+		t.Errorf("/api/v2/orders = %q", w.Body.String())
+	}
+	if w := serve(engine, http.MethodGet, "/api/user/info"); w.Code != http.StatusNotFound {
+		t.Errorf("/api/user/info = %d, want 404", w.Code)
+	}
+}
+
+func TestNoRouteNoMethod(t *testing.T) { //404和405经过引擎中间件
+	engine := New()
+	engine.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			ctx.W.Header().Set("Access-Control-Allow-Origin", "*")
+			next(ctx)
+		}
+	})
+	engine.Group("user").Get("/hello", func(ctx *Context) {})
+
+	w := serve(engine, http.MethodGet, "/user/none")
+	if w.Code != http.StatusNotFound || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("default NoRoute = %d %v", w.Code, w.Header())
+	}
+	w = serve(engine, http.MethodPost, "/user/hello")
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("default NoMethod = %d %v", w.Code, w.Header())
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("NoRoute after serving should panic")
+			}
+		}()
+		engine.NoRoute(func(ctx *Context) {})
+	}()
+
+	custom := New()
+	custom.NoRoute(func(ctx *Context) {
+		ctx.W.WriteHeader(http.StatusNotFound)
+		ctx.W.Write([]byte(`{"error":"not found"}`))
+	})
+	w = serve(custom, http.MethodGet, "/user/none")
+	if w.Code != http.StatusNotFound || w.Body.String() != `{"error":"not found"}` {
+		t.Errorf("custom NoRoute = %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	engine := New()
+	engine.Use(Recovery)
+	g := engine.Group("user")
+	g.Get("/hello", func(ctx *Context) {}, Logging)
+	g.Group("v1").Post("/info", func(ctx *Context) {})
+
+	routes := engine.Routes()
+	if len(routes) != 2 {
+		t.Fatalf("Routes() = %v", routes)
+	}
+	hello := routes[0]
+	if hello.Method != http.MethodGet || hello.Path != "/user/hello" || len(hello.Middlewares) != 2 ||
+		hello.Middlewares[0] != "github.com/bulon99/msgo.Recovery" || hello.Middlewares[1] != "github.com/bulon99/msgo.Logging" {
+		t.Errorf("Routes()[0] = %+v", hello)
+	}
+	if routes[1].Method != http.MethodPost || routes[1].Path != "/user/v1/info" {
+		t.Errorf("Routes()[1] = %+v", routes[1])
+	}
+}
+
+func TestRedirectFixedPath(t *testing.T) {
+	engine := New()
+	engine.RedirectTrailingSlash = true
+	engine.RedirectFixedPath = true
+	g := engine.Group("user")
+	g.Get("/hello", func(ctx *Context) {})
+	g.Post("/list/", func(ctx *Context) {})
+	g.Get("/get/:id", func(ctx *Context) {})
+
+	tests := []struct {
+		method   string
+		path     string
+		code     int
+		location string
+	}{
+		{http.MethodGet, "/user/hello/", http.StatusMovedPermanently, "/user/hello"},
+		{http.MethodPost, "/user/list", http.StatusPermanentRedirect, "/user/list/"},
+		{http.MethodGet, "/User/HELLO?a=1", http.StatusMovedPermanently, "/user/hello?a=1"},
+		{http.MethodGet, "/USER/get/AbC", http.StatusMovedPermanently, "/user/get/AbC"},
+		{http.MethodGet, "/User/Hello/", http.StatusMovedPermanently, "/user/hello"},
+		{http.MethodGet, "/user//a/../hello", http.StatusMovedPermanently, "/user/hello"},
+		{http.MethodGet, "/user//HELLO", http.StatusMovedPermanently, "/user/hello"},
+		{http.MethodGet, "/user//nonexistent", http.StatusNotFound, ""}, //清理后仍不存在的路径不重定向
+	}
+	for _, test := range tests {
+		w := serve(engine, test.method, test.path)
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("%s %s = %d %q, want %d %q", test.method, test.path, w.Code, w.Header().Get("Location"), test.code, test.location)
+		}
+	}
+	if w := serve(engine, http.MethodGet, "/user/none"); w.Code != http.StatusNotFound {
+		t.Errorf("/user/none = %d", w.Code)
+	}
+
+	engine.RedirectFixedPath = false
+	if w := serve(engine, http.MethodGet, "/user//hello"); w.Code != http.StatusOK {
+		t.Errorf("/user//hello = %d, want cleaned path routed", w.Code)
+	}
+}
+
+func TestURL(t *testing.T) { //命名路由反向生成URL
+	engine := New()
+	g := engine.Group("user")
+	g.Get("/hello", func(ctx *Context) {}).Name("user.hello")
+	g.Get("/get/:id<int>/orders/:order", func(ctx *Context) {}).Name("user.order")
+	g.Get("/static/**", func(ctx *Context) {}).Name("user.static")
+
+	tests := []struct {
+		name   string
+		params []any
+		url    string
+	}{
+		{"user.hello", nil, "/user/hello"},
+		{"user.hello", []any{"page", 2}, "/user/hello?page=2"},
+		{"user.order", []any{"id", 1, "order", "a b", "q", "x"}, "/user/get/1/orders/a%20b?q=x"},
+		{"user.static", []any{"**", "css/index.css"}, "/user/static/css/index.css"},
+	}
+	for _, test := range tests {
+		url, err := engine.URL(test.name, test.params...)
+		if err != nil || url != test.url {
+			t.Errorf("URL(%s, %v) = %s %v, want %s", test.name, test.params, url, err, test.url)
+		}
+	}
+	if _, err := engine.URL("user.order", "id", "abc", "order", 1); err == nil {
+		t.Error("id=abc should not match <int>")
+	}
+	if _, err := engine.URL("user.order", "id", 1); err == nil {
+		t.Error("missing param order should fail")
+	}
+	if _, err := engine.URL("none"); err == nil {
+		t.Error("unknown route name should fail")
+	}
+}
+
+func TestHost(t *testing.T) { //虚拟主机路由
+	engine := New()
+	engine.Group("user").Get("/hello", func(ctx *Context) { ctx.W.Write([]byte("default")) })
+	engine.Host("api.example.com").Group("user").Get("/hello", func(ctx *Context) { ctx.W.Write([]byte("api")) })
+	engine.Host(":tenant.example.com").Group("user").Get("/get/:id", func(ctx *Context) {
+		ctx.W.Write([]byte(ctx.Param("tenant") + "-" + ctx.Param("id")))
+	})
+	engine.Host("*.cdn.example.com").Group("user").Get("/hello", func(ctx *Context) { ctx.W.Write([]byte("cdn")) })
+
+	tests := []struct {
+		host string
+		path string
+		body string
+	}{
+		{"api.example.com:8080", "/user/hello", "api"},
+		{"API.example.com", "/user/hello", "api"},
+		{"shop.example.com", "/user/get/1", "shop-1"},
+		{"img.cdn.example.com", "/user/hello", "cdn"},
+		{"localhost", "/user/hello", "default"},
+		{"a.b.example.com", "/user/hello", "default"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, test.path, nil)
+		r.Host = test.host
+		engine.ServeHTTP(w, r)
+		if w.Body.String() != test.body {
+			t.Errorf("%s%s = %q, want %q", test.host, test.path, w.Body.String(), test.body)
+		}
+	}
+}
+
+func TestMiddlewareChain(t *testing.T) { //引擎 > 路由组 > 路由，靠前的在外层
+	engine := New()
+	var trace []string
+	mark := func(name string) MiddlewareFunc {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx *Context) {
+				trace = append(trace, name)
+				next(ctx)
+			}
+		}
+	}
+	engine.Use(mark("engine1"))
+	g := engine.Group("user")
+	g.Use(mark("group1"), mark("group2"))
+	g.Get("/hello", func(ctx *Context) { trace = append(trace, "handler") }, mark("route"))
+	engine.Use(mark("engine2")) //创建路由组之后添加的引擎中间件同样生效
+
+	serve(engine, http.MethodGet, "/user/hello")
+	want := []string{"engine1", "engine2", "group1", "group2", "route", "handler"}
+	if fmt.Sprint(trace) != fmt.Sprint(want) {
+		t.Errorf("middleware order = %v, want %v", trace, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Use after serving should panic")
+		}
+	}()
+	engine.Use(mark("late"))
+}
+
+func TestRouteAfterServing(t *testing.T) {
+	engine := New()
+	g := engine.Group("user")
+	g.Get("/info", func(ctx *Context) {})
+	serve(engine, http.MethodGet, "/user/info")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a route after serving should panic")
+		}
+	}()
+	g.Get("/late", func(ctx *Context) {})
+}
+
+func TestAbort(t *testing.T) {
+	engine := New()
+	var outerSaw bool
+	var outerStatus int
+	engine.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			outerSaw = ctx.IsAborted()
+			outerStatus = ctx.StatusCode
+		}
+	})
+	handled := false
+	g := engine.Group("user")
+	g.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			if ctx.GetHeader("Authorization") == "" {
+				ctx.AbortWithError(http.StatusUnauthorized, errors.New("no token"))
+			}
+			next(ctx) //已中止时调用next也不会执行后续的处理函数
+		}
+	})
+	g.Get("/hello", func(ctx *Context) { handled = true })
+
+	w := serve(engine, http.MethodGet, "/user/hello")
+	if w.Code != http.StatusUnauthorized || handled || !outerSaw || outerStatus != http.StatusUnauthorized {
+		t.Errorf("aborted request = %d handled=%v aborted=%v status=%d", w.Code, handled, outerSaw, outerStatus)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/user/hello", nil)
+	r.Header.Set("Authorization", "token")
+	engine.ServeHTTP(httptest.NewRecorder(), r)
+	if !handled || outerSaw {
+		t.Errorf("request after abort: handled=%v aborted=%v", handled, outerSaw)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":     {Data: []byte("index")},
+		"css/index.css":  {Data: []byte("body{}"), ModTime: time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)},
+		"img/readme.txt": {Data: []byte("img")},
+	}
+	engine := New()
+	g := engine.Group("assets")
+	g.StaticFS("/", http.FS(fsys))
+	engine.Group("app").StaticWithConfig("/", StaticConfig{FS: http.FS(fsys), SPA: true, MaxAge: time.Hour})
+	engine.Group("files").StaticWithConfig("/", StaticConfig{FS: http.FS(fsys), Browse: true})
+
+	w := serve(engine, http.MethodGet, "/assets/css/index.css")
+	if w.Code != http.StatusOK || w.Body.String() != "body{}" || w.Header().Get("ETag") == "" ||
+		w.Header().Get("Last-Modified") == "" || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("css = %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	r := httptest.NewRequest(http.MethodGet, "/assets/css/index.css", nil)
+	r.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match = %d, want 304", w.Code)
+	}
+	if w = serve(engine, http.MethodGet, "/assets/"); w.Body.String() != "index" {
+		t.Errorf("/assets/ = %q", w.Body.String())
+	}
+	if w = serve(engine, http.MethodGet, "/assets/img/"); w.Code != http.StatusNotFound {
+		t.Errorf("directory listing = %d, want 404", w.Code)
+	}
+	if w = serve(engine, http.MethodGet, "/assets/none.js"); w.Code != http.StatusNotFound {
+		t.Errorf("/assets/none.js = %d, want 404", w.Code)
+	}
+	w = serve(engine, http.MethodGet, "/app/orders/1")
+	if w.Body.String() != "index" || w.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Errorf("SPA fallback = %q %v", w.Body.String(), w.Header())
+	}
+
+	if w = serve(engine, http.MethodGet, "/files/img?a=1"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/files/img/?a=1" {
+		t.Errorf("browse without slash = %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w = serve(engine, http.MethodGet, "/files/img/"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `href="readme.txt"`) {
+		t.Errorf("browse /files/img/ = %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestMount(t *testing.T) {
+	sub := New()
+	sub.Group("orders").Get("/:id", func(ctx *Context) { ctx.W.Write([]byte("order " + ctx.Param("id"))) })
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		ctx, ok := FromRequest(r)
+		w.Write([]byte(fmt.Sprint(r.URL.Path, " ", ok && ctx.GetHeader("X-Mw") == "1")))
+	})
+
+	engine := New()
+	g := engine.Group("api")
+	g.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			ctx.R.Header.Set("X-Mw", "1")
+			next(ctx)
+		}
+	})
+	g.Mount("/v2", sub)
+	g.Mount("/admin", mux)
+
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/api/v2/orders/7", "order 7"},
+		{"/api/admin", "/ true"},
+		{"/api/admin/users/1", "/users/1 true"},
+	}
+	for _, test := range tests {
+		if w := serve(engine, http.MethodGet, test.path); w.Body.String() != test.body {
+			t.Errorf("%s = %q, want %q", test.path, w.Body.String(), test.body)
+		}
+	}
+
+	var ran bool
+	h := WrapMiddleware(func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			ctx.AbortWithStatus(http.StatusForbidden)
+			next(ctx)
+		}
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { ran = true }))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusForbidden || ran {
+		t.Errorf("WrapMiddleware = %d ran=%v", w.Code, ran)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	engine := New()
+	engine.ServerConfig.ReadHeaderTimeout = time.Second
+	var order []int
+	engine.OnShutdown(func(ctx context.Context) error { order = append(order, 1); return nil })
+	engine.OnShutdown(func(ctx context.Context) error { order = append(order, 2); return nil })
+
+	done := make(chan error, 1)
+	go func() { done <- engine.Run("127.0.0.1:0") }()
+	for { //等待服务启动
+		engine.serverState.mu.Lock()
+		n := len(engine.serverState.servers)
+		engine.serverState.mu.Unlock()
+		if n == 1 {
+			if srv := engine.serverState.servers[0]; srv.Handler != engine || srv.ReadHeaderTimeout != time.Second {
+				t.Errorf("server = %+v", srv)
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := engine.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Run = %v", err)
+	}
+	if err := engine.Shutdown(context.Background()); err != nil || fmt.Sprint(order) != "[2 1]" { //关闭函数逆序执行且只执行一次
+		t.Errorf("order = %v, err = %v", order, err)
+	}
+	if err := engine.Run("127.0.0.1:0"); !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("Run after Shutdown = %v", err)
+	}
+}
+
+//生成证书和私钥的PEM，parent为nil时生成自签名的CA证书
+func testCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{cn},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tpl.IsCA, tpl.BasicConstraintsValid = true, true
+		tpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	ca, caKey, caPEM, _ := testCert(t, "ca", nil, nil)
+	_, _, serverPEM, serverKeyPEM := testCert(t, "server", ca, caKey)
+	_, _, clientPEM, clientKeyPEM := testCert(t, "client", ca, caKey)
+	config := TLSConfig{
+		CertFile:       write("server.pem", serverPEM),
+		KeyFile:        write("server.key", serverKeyPEM),
+		ClientCAFile:   write("ca.crt", caPEM),
+		ReloadInterval: time.Nanosecond,
+	}
+
+	engine := New()
+	auth := &CertAuth{Allow: func(cert *x509.Certificate) bool { return cert.Subject.CommonName == "client" }}
+	engine.Group("user").Get("/hello", func(ctx *Context) {
+		ctx.W.Write([]byte(ctx.ClientCert().Subject.CommonName))
+	}, auth.Auth)
+	tlsConfig, err := engine.NewTLSConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(engine)
+	srv.TLS = tlsConfig
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) //不输出握手失败的日志
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCert, _ := tls.X509KeyPair(clientPEM, clientKeyPEM)
+	get := func(certs ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+		return client.Get(srv.URL + "/user/hello")
+	}
+	if _, err := get(); err == nil { //未提供客户端证书，握手失败
+		t.Error("request without client certificate succeeded")
+	}
+	resp, err := get(clientCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "client" || resp.TLS.PeerCertificates[0].Subject.CommonName != "server" {
+		t.Errorf("body = %q", body)
+	}
+
+	//替换证书文件后新的连接使用新证书
+	_, _, serverPEM, serverKeyPEM = testCert(t, "server2", ca, caKey)
+	write("server.pem", serverPEM)
+	write("server.key", serverKeyPEM)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(config.CertFile, later, later)
+	resp, err = get(clientCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if cn := resp.TLS.PeerCertificates[0].Subject.CommonName; cn != "server2" {
+		t.Errorf("reloaded certificate = %q", cn)
+	}
+
+	if _, err := engine.NewTLSConfig(TLSConfig{CertFile: config.CertFile, KeyFile: config.KeyFile, ClientAuth: tls.RequireAndVerifyClientCert}); err == nil {
+		t.Error("client verification without ClientCAFile should fail")
+	}
+}
+
+func TestRunListeners(t *testing.T) { //多个监听器共用一次优雅关闭，关闭时等待正在处理的请求
+	dir, err := os.MkdirTemp("", "msgo") //unix socket路径有长度限制，不使用t.TempDir
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "msgo.sock")
+	os.WriteFile(sock, nil, 0600)
+	if _, err := ListenUnix(sock, 0); err == nil {
+		t.Error("ListenUnix should not remove a regular file")
+	}
+	os.Remove(sock)
+
+	engine := New()
+	engine.ServerConfig.UnixSocketMode = 0600
+	started, release := make(chan struct{}), make(chan struct{})
+	engine.Group("user").Get("/slow", func(ctx *Context) {
+		close(started)
+		<-release
+		ctx.W.Write([]byte("done"))
+	})
+	engine.Group("user").Get("/hello", func(ctx *Context) { ctx.W.Write([]byte("hello")) })
+	var hooked bool
+	engine.OnShutdown(func(ctx context.Context) error { hooked = true; return nil })
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unix, err := ListenUnix(sock, engine.ServerConfig.UnixSocketMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(sock); info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 { //创建socket的临时目录已删除
+		t.Errorf("socket dir entries = %v", entries)
+	}
+	done := make(chan error, 1)
+	go func() { done <- engine.RunListeners(tcp, unix) }()
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", sock)
+		},
+	}}
+	resp, err := unixClient.Get("http://unix/user/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello" {
+		t.Errorf("unix body = %q", body)
+	}
+
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + tcp.Addr().String() + "/user/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		slow <- string(body)
+	}()
+	<-started
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- engine.Shutdown(context.Background()) }()
+	select {
+	case <-shutdown:
+		t.Fatal("Shutdown returned before the in-flight request finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if body := <-slow; body != "done" {
+		t.Errorf("slow body = %q", body)
+	}
+	if err := <-shutdown; err != nil || !hooked {
+		t.Errorf("Shutdown = %v, hooked = %v", err, hooked)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("RunListeners = %v", err)
+	}
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("socket file not removed: %v", err)
+	}
+}
+
+func TestGrpc(t *testing.T) { //HTTP和gRPC共用端口
+	engine := New()
+	engine.Group("user").Get("/hello", func(ctx *Context) { ctx.W.Write([]byte("hello")) })
+	grpcServer := rpc.NewSharedGrpcServer()
+	grpcServer.Register(func(g *grpc.Server) {
+		healthpb.RegisterHealthServer(g, health.NewServer())
+	}, "", "", 0, "")
+	engine.Grpc(grpcServer)
+	engine.OnShutdown(func(ctx context.Context) error { grpcServer.Stop(); return nil })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- engine.RunListener(listener) }()
+	addr := listener.Addr().String()
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil || res.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("grpc health = %v, %v", res, err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Register after serving should panic")
+			}
+		}()
+		grpcServer.Register(func(g *grpc.Server) {}, "", "", 0, "")
+	}()
+
+	resp, err := http.Get("http://" + addr + "/user/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello" {
+		t.Errorf("http body = %q", body)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Grpc after Run should panic")
+			}
+		}()
+		engine.Grpc(grpcServer)
+	}()
+
+	if err := engine.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("RunListener = %v", err)
+	}
+}
+
+func TestResponseWriter(t *testing.T) { //Render发送传入的状态码，响应体写入前可以修改响应头
+	engine := New()
+	var out bytes.Buffer
+	engine.Use(func(next HandlerFunc) HandlerFunc {
+		return LoggerWithConfig(LoggerConfig{Formatter: defaultLogFormatter, Out: &out}, next)
+	})
+	g := engine.Group("user")
+	var written []bool
+	var size int
+	g.Get("/json", func(ctx *Context) {
+		ctx.W.WriteHeader(http.StatusTeapot)
+		written = append(written, ctx.W.Written())
+		ctx.JSON(http.StatusNotFound, "missing")
+		written = append(written, ctx.W.Written())
+		ctx.W.Header().Set("X-Late", "1") //已发送响应头，不再生效
+		ctx.W.WriteHeader(http.StatusOK)
+		size = ctx.W.Size()
+	})
+	g.Get("/abort", func(ctx *Context) {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+	})
+	g.Get("/flush", func(ctx *Context) {
+		ctx.W.WriteHeader(http.StatusAccepted)
+		ctx.W.Flush()
+	})
+
+	w := serve(engine, http.MethodGet, "/user/json")
+	if w.Code != http.StatusNotFound || w.Result().Header.Get("Content-Type") != "application/json; charset=utf-8" || w.Result().Header.Get("X-Late") != "" {
+		t.Errorf("json = %d %v", w.Code, w.Result().Header)
+	}
+	if fmt.Sprint(written) != "[false true]" || size != w.Body.Len() {
+		t.Errorf("written = %v, size = %d, body = %d", written, size, w.Body.Len())
+	}
+	if !strings.Contains(out.String(), "404") {
+		t.Errorf("log = %q", out.String())
+	}
+	if w := serve(engine, http.MethodGet, "/user/abort"); w.Code != http.StatusUnauthorized {
+		t.Errorf("abort = %d", w.Code)
+	}
+	if w := serve(engine, http.MethodGet, "/user/flush"); w.Code != http.StatusAccepted || !w.Flushed {
+		t.Errorf("flush = %d %v", w.Code, w.Flushed)
+	}
+	if w := serve(engine, http.MethodHead, "/user/json"); w.Code != http.StatusNotFound || w.Body.Len() != 0 || size == 0 {
+		t.Errorf("HEAD = %d %q size = %d", w.Code, w.Body.String(), size)
+	}
+}
+
+func TestContextReset(t *testing.T) { //从池中取出的Context不带有上一个请求的数据
+	engine := New()
+	ctx := engine.allocateContext().(*Context)
+	ctx.reset(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?a=1", nil))
+	ctx.Set("user", "bob")
+	ctx.IsValidate, ctx.DisallowUnknownFields, ctx.StatusCode = true, true, http.StatusTeapot
+	ctx.GetQuery("a")
+	ctx.W.WriteHeader(http.StatusTeapot)
+	ctx.AbortWithError(http.StatusTeapot, errors.New("teapot"))
+
+	w := httptest.NewRecorder()
+	ctx.reset(w, httptest.NewRequest(http.MethodGet, "/?a=2", nil))
+	if _, ok := ctx.Get("user"); ok || ctx.IsValidate || ctx.DisallowUnknownFields || ctx.StatusCode != 0 ||
+		ctx.IsAborted() || len(ctx.Errors) != 0 || ctx.W.Status() != http.StatusOK || ctx.W.Written() {
+		t.Errorf("context not reset: %+v", ctx)
+	}
+	if a := ctx.GetQuery("a"); a != "2" {
+		t.Errorf("query a = %q", a)
+	}
+}
+
+func TestContextCopy(t *testing.T) { //副本在处理函数返回后仍可在其他协程中读取
+	engine := New()
+	copies := make(chan *Context, 2)
+	engine.Group("user").Get("/get/:id", func(ctx *Context) {
+		ctx.Set("user", ctx.Param("id"))
+		ctx.GetQuery("q")
+		copies <- ctx.Copy()
+		ctx.String(http.StatusOK, "ok")
+	})
+	serve(engine, http.MethodGet, "/user/get/1?q=a")
+	serve(engine, http.MethodGet, "/user/get/2?q=b") //复用同一个Context
+
+	for _, want := range []string{"1", "2"} {
+		cp := <-copies
+		done := make(chan string)
+		go func() {
+			user, _ := cp.Get("user")
+			done <- fmt.Sprint(cp.Param("id"), user, cp.GetQuery("q"))
+		}()
+		if got := <-done; got != want+want+map[string]string{"1": "a", "2": "b"}[want] {
+			t.Errorf("copy = %q", got)
+		}
+		if err := cp.String(http.StatusOK, "late"); err == nil {
+			t.Error("copied Context wrote the response")
+		}
+	}
+}
+
+func TestContextContext(t *testing.T) { //Context作为context.Context使用
+	engine := New()
+	engine.Group("user").Get("/hello", func(ctx *Context) {
+		ctx.Set("user", "bob")
+		var c context.Context = ctx
+		deadline, ok := c.Deadline()
+		from, _ := FromRequest(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(c))
+		ctx.String(http.StatusOK, "%v %v %v %v %v", c.Value("user"), c.Value(testKey{}), ok && !deadline.IsZero(), from == ctx, c.Err())
+	})
+	base, cancel := context.WithTimeout(context.WithValue(context.Background(), testKey{}, "v"), time.Minute)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/hello", nil).WithContext(base))
+	if w.Body.String() != "bob v true true <nil>" {
+		t.Errorf("body = %q", w.Body.String())
+	}
+
+	cancel() //客户端断开连接
+	ctx := engine.allocateContext().(*Context)
+	ctx.reset(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(base))
+	select {
+	case <-ctx.Done():
+	default:
+		t.Error("Done not closed after the request was canceled")
+	}
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("Err = %v", ctx.Err())
+	}
+}
+
+type testKey struct{}
+
+func TestNegotiate(t *testing.T) {
+	engine := New()
+	engine.SetHtmlTemplate(template.Must(template.New("user.html").Parse("<b>{{.}}</b>")))
+	engine.Group("user").Get("/info", func(ctx *Context) {
+		ctx.Negotiate(http.StatusCreated, NegotiateConfig{HTMLName: "user.html", XMLData: struct {
+			XMLName struct{} `xml:"user"`
+			Name    string   `xml:"name"`
+		}{Name: "bob"}, Data: "bob"})
+	})
+	engine.Group("custom").Get("/info", func(ctx *Context) { //自定义格式，带参数的格式按去掉参数后的类型渲染
+		ctx.Negotiate(http.StatusOK, NegotiateConfig{
+			Offered: []string{"application/json; charset=utf-8", "application/yaml"},
+			Data:    "name: bob\n",
+		})
+	})
+	tests := []struct {
+		accept, contentType, body string
+	}{
+		{"", "application/json; charset=utf-8", `"bob"`},
+		{"application/json", "application/json; charset=utf-8", `"bob"`},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html; charset=utf-8", "<b>bob</b>"},
+		{"application/xml;q=0.9, application/json;q=0.5", "application/xml; charset=utf-8", "<user><name>bob</name></user>"},
+		{"text/xml", "application/xml; charset=utf-8", "<user><name>bob</name></user>"},
+		{"text/*;q=0.5, text/html;q=0", "text/plain; charset=utf-8", "bob"},
+		{"*/*", "application/json; charset=utf-8", `"bob"`},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/user/info", nil)
+		req.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated || w.Header().Get("Content-Type") != test.contentType || strings.TrimSpace(w.Body.String()) != test.body {
+			t.Errorf("Accept %q = %d %q %q", test.accept, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/user/info", nil)
+	req.Header.Set("Accept", "image/png, application/json;q=0")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	if w.Code != http.StatusNotAcceptable || w.Header().Get("Vary") != "Accept" {
+		t.Errorf("not acceptable = %d %v", w.Code, w.Header())
+	}
+
+	customTests := []struct {
+		accept, contentType, body string
+	}{
+		{"application/yaml", "application/yaml", "name: bob\n"},
+		{"application/json", "application/json; charset=utf-8", `"name: bob\n"`},
+	}
+	for _, test := range customTests {
+		req := httptest.NewRequest(http.MethodGet, "/custom/info", nil)
+		req.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != test.contentType || strings.TrimSpace(w.Body.String()) != strings.TrimSpace(test.body) {
+			t.Errorf("Accept %q = %d %q %q", test.accept, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
+
+func TestBind(t *testing.T) { //根据请求方法和Content-Type选择绑定方式，转换字段类型后验证
+	type Page struct {
+		Size int `form:"size" query:"page_size" json:"size"`
+	}
+	type Search struct {
+		Page
+		Name    string        `form:"name" json:"name" validate:"required"`
+		Tags    []string      `form:"tag" json:"tags"`
+		IDs     []uint        `form:"id"`
+		Active  *bool         `form:"active"`
+		Since   time.Time     `form:"since" time_format:"2006-01-02"`
+		At      time.Time     `form:"at" time_format:"unix"`
+		Timeout time.Duration `form:"timeout"`
+		Score   float64       `form:"score"`
+		Skip    string        `form:"-"`
+	}
+	type Meta struct {
+		RequestID string `header:"x-request-id"`
+		Retry     int    `header:"X-Retry"`
+	}
+	type Path struct {
+		ID int `uri:"id" validate:"min=1"`
+	}
+	engine := New()
+	var got Search
+	var meta Meta
+	var path Path
+	var bindErr error
+	g := engine.Group("user")
+	g.Any("/search", func(ctx *Context) {
+		got = Search{}
+		bindErr = ctx.Bind(&got)
+	})
+	g.Get("/query", func(ctx *Context) {
+		got = Search{}
+		bindErr = ctx.BindQuery(&got)
+	})
+	g.Get("/get/:id", func(ctx *Context) {
+		meta, path = Meta{}, Path{}
+		if bindErr = ctx.BindHeader(&meta); bindErr == nil {
+			bindErr = ctx.BindUri(&path)
+		}
+	})
+
+	query := "/user/search?name=bob&tag=a&tag=b&id=1&id=2&active=true&since=2022-09-01&at=1662000000&timeout=1m&score=1.5&size=10&Skip=x"
+	w := serve(engine, http.MethodGet, query)
+	if bindErr != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET bind = %v %d", bindErr, w.Code)
+	}
+	since, _ := time.ParseInLocation("2006-01-02", "2022-09-01", time.Local)
+	if got.Name != "bob" || fmt.Sprint(got.Tags, got.IDs) != "[a b] [1 2]" || got.Active == nil || !*got.Active ||
+		!got.Since.Equal(since) || got.At.Unix() != 1662000000 || got.Timeout != time.Minute || got.Score != 1.5 || got.Size != 10 || got.Skip != "" {
+		t.Errorf("GET bind = %+v", got)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/user/search", strings.NewReader("name=alice&tag=x&size=3"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+	if bindErr != nil || got.Name != "alice" || fmt.Sprint(got.Tags) != "[x]" || got.Size != 3 {
+		t.Errorf("form bind = %v %+v", bindErr, got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/user/search", strings.NewReader(`{"name":"carol","tags":["j"],"size":5}`))
+	req.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+	if bindErr != nil || got.Name != "carol" || fmt.Sprint(got.Tags) != "[j]" || got.Size != 5 {
+		t.Errorf("json bind = %v %+v", bindErr, got)
+	}
+
+	if w := serve(engine, http.MethodGet, "/user/query?name=dave&page_size=7&size=1"); bindErr != nil || got.Size != 7 || w.Code != http.StatusOK {
+		t.Errorf("query bind = %v %+v", bindErr, got)
+	}
+	if w := serve(engine, http.MethodGet, "/user/search?size=1"); bindErr == nil || w.Code != http.StatusBadRequest { //name必填
+		t.Errorf("validate = %v %d", bindErr, w.Code)
+	}
+	if w := serve(engine, http.MethodGet, "/user/search?name=bob&size=x"); bindErr == nil || w.Code != http.StatusBadRequest {
+		t.Errorf("conversion = %v %d", bindErr, w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/user/get/42", nil)
+	req.Header.Set("X-Request-Id", "abc")
+	req.Header.Set("X-Retry", "3")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+	if bindErr != nil || meta != (Meta{RequestID: "abc", Retry: 3}) || path.ID != 42 {
+		t.Errorf("header/uri bind = %v %+v %+v", bindErr, meta, path)
+	}
+	if w := serve(engine, http.MethodGet, "/user/get/0"); bindErr == nil || w.Code != http.StatusBadRequest {
+		t.Errorf("uri validate = %v %d", bindErr, w.Code)
+	}
+}
+
+func TestBindMultipart(t *testing.T) { //multipart表单中的文件绑定到结构体，按文件内容验证类型
+	type Upload struct {
+		Name   string                  `form:"name" validate:"required"`
+		Avatar *multipart.FileHeader   `form:"avatar" validate:"required,maxsize=1KB,mimetypes=image/png image/jpeg"`
+		Photos []*multipart.FileHeader `form:"photos" validate:"max=2,maxsize=1KB,mimetypes=image/*"`
+	}
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+	type file struct {
+		field string
+		data  []byte
+	}
+	request := func(files ...file) *http.Request {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("name", "bob")
+		for i, f := range files {
+			h := make(textproto.MIMEHeader)
+			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename="%d.png"`, f.field, i))
+			h.Set("Content-Type", "image/png") //客户端传的类型不可信
+			part, _ := mw.CreatePart(h)
+			part.Write(f.data)
+		}
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/user/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		return req
+	}
+
+	dir := t.TempDir()
+	engine := New()
+	var upload Upload
+	var bindErr error
+	engine.Group("user").Post("/upload", func(ctx *Context) {
+		upload = Upload{}
+		if bindErr = ctx.Bind(&upload); bindErr == nil {
+			bindErr = ctx.SaveUploadedFile(upload.Avatar, filepath.Join(dir, upload.Avatar.Filename))
+		}
+	})
+
+	engine.ServeHTTP(httptest.NewRecorder(), request(file{"avatar", png}, file{"photos", png}, file{"photos", png}))
+	if bindErr != nil || upload.Name != "bob" || upload.Avatar == nil || len(upload.Photos) != 2 {
+		t.Fatalf("bind = %v %+v", bindErr, upload)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, upload.Avatar.Filename)); !bytes.Equal(data, png) {
+		t.Error("saved file differs from the upload")
+	}
+
+	tests := []struct {
+		name  string
+		files []file
+	}{
+		{"missing avatar", []file{{"photos", png}}},
+		{"too many photos", []file{{"avatar", png}, {"photos", png}, {"photos", png}, {"photos", png}}},
+		{"avatar too large", []file{{"avatar", append(png, make([]byte, 1024)...)}}},
+		{"text sent as png", []file{{"avatar", []byte("hello world")}}},
+		{"photo not an image", []file{{"avatar", png}, {"photos", []byte("%PDF-1.4")}}},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, request(test.files...))
+		if bindErr == nil || w.Code != http.StatusBadRequest {
+			t.Errorf("%s: bind = %v %d", test.name, bindErr, w.Code)
+		}
+	}
+}
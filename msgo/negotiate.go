@@ -0,0 +1,159 @@
+package msgo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	MIMEJSON  = "application/json"
+	MIMEXML   = "application/xml"
+	MIMEXML2  = "text/xml"
+	MIMEHTML  = "text/html"
+	MIMEPlain = "text/plain"
+)
+
+var ErrNotAcceptable = errors.New("msgo: the accepted formats are not offered by the server")
+
+//内容协商的配置，根据Accept请求头选择返回的格式
+type NegotiateConfig struct {
+	//可返回的格式，为空时为JSON、XML(application/xml和text/xml)、纯文本，设置了HTMLName时包括HTML
+	//其他格式(如application/yaml)以该格式作为Content-Type原样写入Data，Data为字符串或[]byte以外的类型时使用fmt.Fprint
+	Offered  []string
+	HTMLName string //预加载模板的名称
+	HTMLData any
+	JSONData any
+	XMLData  any
+	Data     any //未单独设置某种格式的数据时使用
+}
+
+//Accept请求头中的一项，如 text/html;q=0.8
+type acceptRange struct {
+	typ, subtype string
+	q            float64
+}
+
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		typ, subtype, ok := strings.Cut(mediaType, "/")
+		if !ok || typ == "" || subtype == "" {
+			continue
+		}
+		r := acceptRange{typ: typ, subtype: subtype, q: 1}
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(key) != "q" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(value, 64); err == nil && q >= 0 && q <= 1 {
+				r.q = q
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+//offered在Accept中的q值，由匹配的最具体的一项决定，specificity为-1表示不匹配
+func (r acceptRange) match(offered string) (specificity int) {
+	typ, subtype, _ := strings.Cut(offered, "/")
+	switch {
+	case r.typ == typ && r.subtype == subtype:
+		return 2
+	case r.typ == typ && r.subtype == "*":
+		return 1
+	case r.typ == "*" && r.subtype == "*":
+		return 0
+	}
+	return -1
+}
+
+//根据Accept请求头从offered中选出客户端最想要的格式，q值相同时优先选择offered中靠前的
+//没有Accept请求头时返回offered[0]，都不接受时返回空字符串
+func (c *Context) NegotiateFormat(offered ...string) string {
+	if len(offered) == 0 {
+		return ""
+	}
+	accept := c.R.Header.Get("Accept")
+	if accept == "" {
+		return offered[0]
+	}
+	ranges := parseAccept(accept)
+	best, bestQ := "", 0.0
+	for _, format := range offered {
+		mediaType := mediaType(format)
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			if s := r.match(mediaType); s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+//根据Accept请求头使用JSON、XML、预加载的模板或纯文本返回数据，都不接受时返回406和ErrNotAcceptable
+func (c *Context) Negotiate(status int, config NegotiateConfig) error {
+	offered := config.Offered
+	if len(offered) == 0 {
+		offered = []string{MIMEJSON, MIMEXML, MIMEPlain, MIMEXML2} //text/* 优先返回纯文本
+		if config.HTMLName != "" {
+			offered = append(offered, MIMEHTML)
+		}
+	}
+	c.W.Header().Add("Vary", "Accept")
+	format := c.NegotiateFormat(offered...)
+	if format == "" {
+		return c.AbortWithError(http.StatusNotAcceptable, ErrNotAcceptable)
+	}
+	switch mediaType(format) {
+	case MIMEJSON:
+		return c.JSON(status, negotiateData(config.JSONData, config.Data))
+	case MIMEXML, MIMEXML2:
+		return c.XML(status, negotiateData(config.XMLData, config.Data))
+	case MIMEHTML:
+		c.StatusCode = status
+		c.W.WriteHeader(status)
+		return c.Template(config.HTMLName, negotiateData(config.HTMLData, config.Data))
+	case MIMEPlain:
+		return c.String(status, "%v", config.Data)
+	}
+	return c.negotiateCustom(status, format, config.Data)
+}
+
+//去掉参数并转为小写，如 application/JSON; charset=utf-8 -> application/json
+func mediaType(format string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(format, ";")[0]))
+}
+
+func (c *Context) negotiateCustom(status int, format string, data any) (err error) {
+	c.W.Header().Set("Content-Type", format)
+	c.StatusCode = status
+	c.W.WriteHeader(status)
+	switch data := data.(type) {
+	case []byte:
+		_, err = c.W.Write(data)
+	case string:
+		_, err = io.WriteString(c.W, data)
+	default:
+		_, err = fmt.Fprint(c.W, data)
+	}
+	return
+}
+
+func negotiateData(data, fallback any) any {
+	if data != nil {
+		return data
+	}
+	return fallback
+}
@@ -26,6 +26,8 @@ func Recovery(next HandlerFunc) HandlerFunc {
 		defer func() {
 			if err := recover(); err != nil {
 				ctx.Logger.Error(detailMsg(err))
+				ctx.Errors = append(ctx.Errors, fmt.Errorf("%v", err))
+				ctx.Abort()
 				ctx.Fail(http.StatusInternalServerError, "Internal Server Error")
 			}
 		}()
@@ -0,0 +1,135 @@
+package msgo
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+const noWritten = -1
+
+//Context.W的类型，记录状态码和写入的字节数
+//WriteHeader只记录状态码，第一次写入响应体(或WriteHeaderNow、Flush)时才发送响应头，
+//所以在写入响应体之前都可以修改响应头和状态码
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	http.Pusher
+	Status() int     //响应的状态码，未设置时为200
+	Size() int       //已写入响应体的字节数，未发送响应头时为-1
+	Written() bool   //响应头是否已经发送
+	WriteHeaderNow() //立即发送响应头
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	discardBody bool //HEAD请求使用GET的处理函数时，保留响应头和状态码，丢弃响应体
+}
+
+var _ ResponseWriter = (*responseWriter)(nil)
+
+func (w *responseWriter) reset(writer http.ResponseWriter) {
+	w.ResponseWriter = writer
+	w.status = http.StatusOK
+	w.size = noWritten
+	w.discardBody = false
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if code > 0 && !w.Written() { //响应头发送后不能再修改状态码
+		w.status = code
+	}
+}
+
+func (w *responseWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.size = 0
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.WriteHeaderNow()
+	if w.discardBody {
+		w.size += len(b)
+		return len(b), nil
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) WriteString(s string) (int, error) {
+	w.WriteHeaderNow()
+	if w.discardBody {
+		w.size += len(s)
+		return len(s), nil
+	}
+	n, err := io.WriteString(w.ResponseWriter, s)
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+func (w *responseWriter) Written() bool {
+	return w.size != noWritten
+}
+
+func (w *responseWriter) Flush() {
+	w.WriteHeaderNow()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("msgo: the ResponseWriter doesn't support hijacking")
+	}
+	if w.size < 0 { //连接被接管后不再发送响应头
+		w.size = 0
+	}
+	return hijacker.Hijack()
+}
+
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+//供http.ResponseController使用
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+var errCopiedContext = errors.New("msgo: the copied Context can't write the response")
+
+//Copy得到的Context使用的ResponseWriter，原请求的响应可能已经结束，写入时返回错误
+type detachedResponseWriter struct {
+	header http.Header
+}
+
+func (w detachedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w detachedResponseWriter) Write([]byte) (int, error) {
+	return 0, errCopiedContext
+}
+
+func (w detachedResponseWriter) WriteHeader(int) {}
@@ -0,0 +1,145 @@
+package msgo
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+//路由信息，用于审计、生成文档以及测试
+type RouteInfo struct {
+	Name        string //路由名称，未命名时为空
+	Method      string
+	Host        string   //虚拟主机，默认路由为空
+	Path        string   //完整路径，包含路由组前缀
+	Handler     string   //处理函数名称
+	Middlewares []string //中间件名称，按执行顺序依次为引擎、路由组(由外到内)和路由方法级别的中间件
+}
+
+type RoutesInfo []RouteInfo
+
+//返回按注册顺序排列的全部路由，默认路由在前，虚拟主机路由在后
+func (e *Engine) Routes() RoutesInfo {
+	routes := make(RoutesInfo, 0, len(e.router.routes))
+	for _, rt := range e.router.routes {
+		routes = append(routes, rt.info())
+	}
+	for _, h := range e.hosts {
+		for _, rt := range h.router.routes {
+			routes = append(routes, rt.info())
+		}
+	}
+	return routes
+}
+
+func (r *Route) info() RouteInfo {
+	var middlewares []string
+	for _, middlewareFunc := range r.middlewareChain() {
+		middlewares = append(middlewares, nameOfFunction(middlewareFunc))
+	}
+	return RouteInfo{
+		Name:        r.name,
+		Method:      r.method,
+		Host:        r.group.router.host,
+		Path:        r.path,
+		Handler:     nameOfFunction(r.handlerFunc),
+		Middlewares: middlewares,
+	}
+}
+
+func nameOfFunction(f any) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
+
+func (e *Engine) debugPrintRoutes() { //调试模式下打印路由表
+	if !e.Debug {
+		return
+	}
+	for _, info := range e.Routes() {
+		fmt.Fprintf(defaultWriter, "[msgo-debug] %-7s %-25s --> %s (%d middlewares)\n",
+			info.Method, info.Host+info.Path, info.Handler, len(info.Middlewares))
+	}
+}
+
+//设置路由名称，名称在引擎内唯一，用于通过Engine.URL反向生成URL
+func (r *Route) Name(name string) *Route {
+	router := r.group.router
+	if _, ok := router.names[name]; ok {
+		panic(fmt.Sprintf("路由名称 %s 重复", name))
+	}
+	r.name = name
+	router.names[name] = r
+	return r
+}
+
+//根据路由名称生成URL，params为键值对，如 URL("user.get", "id", 1, "page", 2)
+//与路由参数同名的值替换路径中的 :参数、*、**，其余的作为query参数
+func (e *Engine) URL(name string, params ...any) (string, error) {
+	rt, ok := e.router.names[name]
+	if !ok {
+		return "", fmt.Errorf("route %s not found", name)
+	}
+	if len(params)%2 != 0 {
+		return "", errors.New("params must be key value pairs")
+	}
+	values := make(map[string]string, len(params)/2)
+	keys := make([]string, 0, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		key, ok := params[i].(string)
+		if !ok {
+			return "", fmt.Errorf("param key %v must be a string", params[i])
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = fmt.Sprint(params[i+1])
+	}
+	tokens, err := tokenize(rt.path)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, token := range tokens {
+		if token.kind == staticKind {
+			sb.WriteString(token.text)
+			continue
+		}
+		node := &treeNode{key: token.text}
+		if token.kind == paramKind {
+			if node, err = newParamNode(token.text, token.kind); err != nil {
+				return "", err
+			}
+		}
+		value, ok := values[node.key]
+		if !ok {
+			return "", fmt.Errorf("route %s: missing param %s", name, node.key)
+		}
+		delete(values, node.key)
+		if node.constraint != nil && !node.constraint.MatchString(value) {
+			return "", fmt.Errorf("route %s: param %s=%s does not match %s", name, node.key, value, token.text)
+		}
+		if token.kind == catchAllKind { //** 保留其中的/
+			segments := strings.Split(value, "/")
+			for i, segment := range segments {
+				segments[i] = url.PathEscape(segment)
+			}
+			sb.WriteString(strings.Join(segments, "/"))
+		} else {
+			sb.WriteString(url.PathEscape(value))
+		}
+	}
+	query := url.Values{}
+	for _, key := range keys {
+		if value, ok := values[key]; ok {
+			query.Add(key, value)
+		}
+	}
+	if len(query) > 0 {
+		sb.WriteString("?")
+		sb.WriteString(query.Encode())
+	}
+	return sb.String(), nil
+}
@@ -2,11 +2,14 @@ package rpc
 
 import (
 	"context"
+	"errors"
 	"github.com/bulon99/msgo/register"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
 	"net"
+	"net/http"
+	"sync"
 	"time"
 )
 
@@ -15,6 +18,9 @@ type MsGrpcServer struct {
 	listen    net.Listener
 	server    *grpc.Server
 	registers []func(g *grpc.Server)
+	mu        sync.Mutex
+	serving   bool //已开始处理请求，grpc.Server处理请求时不加锁读取服务表，不能再注册服务
+	serveOnce sync.Once
 }
 
 func NewGrpcServer(address string, ops ...grpc.ServerOption) (*MsGrpcServer, error) {
@@ -30,19 +36,52 @@ func NewGrpcServer(address string, ops ...grpc.ServerOption) (*MsGrpcServer, err
 	return ms, nil
 }
 
+//不监听端口，通过msgo.Engine.Grpc与HTTP服务共用端口
+func NewSharedGrpcServer(ops ...grpc.ServerOption) *MsGrpcServer {
+	return &MsGrpcServer{
+		server: grpc.NewServer(ops...),
+	}
+}
+
 func (s *MsGrpcServer) Run() error {
+	if s.listen == nil {
+		return errors.New("rpc: shared grpc server is served by msgo.Engine")
+	}
+	s.startServing()
 	for _, regis := range s.registers {
 		regis(s.server)
 	}
 	return s.server.Serve(s.listen)
 }
 
+//与HTTP服务共用端口时处理gRPC请求，第一次请求后不能再注册服务
+func (s *MsGrpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.serveOnce.Do(s.startServing)
+	s.server.ServeHTTP(w, r)
+}
+
+func (s *MsGrpcServer) startServing() {
+	s.mu.Lock()
+	s.serving = true
+	s.mu.Unlock()
+}
+
 func (s *MsGrpcServer) Stop() {
 	s.server.Stop()
 }
 
 func (s *MsGrpcServer) Register(reg func(grpServer *grpc.Server), serviceName, host string, port uint64, Type string) {
-	s.registers = append(s.registers, reg)
+	s.mu.Lock()
+	if s.serving {
+		s.mu.Unlock()
+		panic("gRPC服务已开始处理请求，不能再注册服务")
+	}
+	if s.listen == nil { //共用端口时没有Run，立即注册
+		reg(s.server)
+	} else {
+		s.registers = append(s.registers, reg)
+	}
+	s.mu.Unlock()
 	//注册到nacos
 	if Type == "nacos" {
 		client, err := register.CreateNacosClient()
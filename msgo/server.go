@@ -0,0 +1,267 @@
+package msgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//创建http.Server时使用的配置，零值表示不限制
+type ServerConfig struct {
+	ReadTimeout       time.Duration //读取整个请求(包括请求体)的超时时间
+	ReadHeaderTimeout time.Duration //读取请求头的超时时间
+	WriteTimeout      time.Duration //写响应的超时时间
+	IdleTimeout       time.Duration //keep-alive连接等待下一个请求的超时时间
+	MaxHeaderBytes    int           //请求头的最大字节数，0使用http.DefaultMaxHeaderBytes
+	UnixSocketMode    os.FileMode   //RunUnix创建的socket文件的权限，0使用默认权限
+}
+
+//关闭时执行的函数，在所有请求处理完成后按注册的逆序执行
+type ShutdownHook func(ctx context.Context) error
+
+type serverState struct {
+	mu           sync.Mutex
+	servers      []*http.Server
+	hooks        []ShutdownHook
+	shutdown     bool //已关闭，不能再启动新的服务
+	shutdownOnce sync.Once
+	hookErr      error
+}
+
+func (e *Engine) newServer(addr string) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           e.serverHandler(),
+		ReadTimeout:       e.ServerConfig.ReadTimeout,
+		ReadHeaderTimeout: e.ServerConfig.ReadHeaderTimeout,
+		WriteTimeout:      e.ServerConfig.WriteTimeout,
+		IdleTimeout:       e.ServerConfig.IdleTimeout,
+		MaxHeaderBytes:    e.ServerConfig.MaxHeaderBytes,
+	}
+	s := &e.serverState
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdown {
+		return nil, http.ErrServerClosed
+	}
+	s.servers = append(s.servers, srv)
+	return srv, nil
+}
+
+//调用Shutdown关闭服务时Serve返回http.ErrServerClosed，不作为错误
+func serveError(err error) error {
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (e *Engine) Run(addr string) error {
+	e.debugPrintRoutes()
+	srv, err := e.newServer(addr)
+	if err != nil {
+		return err
+	}
+	return serveError(srv.ListenAndServe())
+}
+
+func (e *Engine) RunTLS(addr, certFile, keyFile string) error { //https支持
+	e.debugPrintRoutes()
+	srv, err := e.newServer(addr)
+	if err != nil {
+		return err
+	}
+	return serveError(srv.ListenAndServeTLS(certFile, keyFile))
+}
+
+func (e *Engine) RunListener(listener net.Listener) error {
+	return e.RunListeners(listener)
+}
+
+//在unix domain socket上启动服务
+func (e *Engine) RunUnix(path string) error {
+	listener, err := ListenUnix(path, e.ServerConfig.UnixSocketMode)
+	if err != nil {
+		return err
+	}
+	return e.RunListener(listener)
+}
+
+//同时在多个监听器上启动服务，如对外端口、管理端口和unix socket，调用Shutdown时一起关闭
+//其中一个出错时关闭其他服务并返回该错误
+func (e *Engine) RunListeners(listeners ...net.Listener) error {
+	if len(listeners) == 0 {
+		return errors.New("msgo: no listeners")
+	}
+	e.debugPrintRoutes()
+	servers := make([]*http.Server, len(listeners))
+	for i, listener := range listeners {
+		srv, err := e.newServer(listener.Addr().String())
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return err
+		}
+		servers[i] = srv
+	}
+	errCh := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func(srv *http.Server, listener net.Listener) {
+			errCh <- serveError(srv.Serve(listener))
+		}(srv, listeners[i])
+	}
+	var first error
+	for range servers {
+		if err := <-errCh; err != nil && first == nil {
+			first = err
+			for _, srv := range servers {
+				srv.Close()
+			}
+		}
+	}
+	return first
+}
+
+//监听unix domain socket，删除上次未正常退出时残留的socket文件，mode不为0时设置文件权限
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("msgo: %s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil { //仍有服务在使用
+			conn.Close()
+			return nil, fmt.Errorf("msgo: socket %s is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	if mode == 0 {
+		return net.Listen("unix", path)
+	}
+	//先在只有当前用户能访问的临时目录中创建socket并修改权限，再移动到path，不存在权限过宽的时间窗口
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".msgo-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "sock")
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	unixListener := listener.(*net.UnixListener)
+	unixListener.SetUnlinkOnClose(false) //监听的是临时路径，关闭时删除移动后的文件
+	return &movedUnixListener{UnixListener: unixListener, path: path}, nil
+}
+
+type movedUnixListener struct {
+	*net.UnixListener
+	path string
+	once sync.Once
+}
+
+func (l *movedUnixListener) Close() error {
+	err := l.UnixListener.Close()
+	l.once.Do(func() {
+		os.Remove(l.path)
+	})
+	return err
+}
+
+//注册关闭时执行的函数，如关闭数据库、连接池、gRPC服务、注销服务等
+func (e *Engine) OnShutdown(hook ShutdownHook) {
+	s := &e.serverState
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+//优雅关闭：停止接收新连接，等待正在处理的请求完成后执行关闭函数
+//ctx到期时不再等待请求，仍会执行关闭函数并返回ctx的错误，关闭函数只执行一次
+func (e *Engine) Shutdown(ctx context.Context) error {
+	s := &e.serverState
+	s.mu.Lock()
+	s.shutdown = true
+	servers := s.servers
+	s.servers = nil
+	s.mu.Unlock()
+
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			errs[i] = srv.Shutdown(ctx)
+		}(i, srv)
+	}
+	wg.Wait()
+	s.shutdownOnce.Do(func() {
+		s.mu.Lock()
+		hooks := s.hooks
+		s.mu.Unlock()
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if err := hooks[i](ctx); err != nil && s.hookErr == nil {
+				s.hookErr = err
+			}
+		}
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return s.hookErr
+}
+
+//启动服务并在收到SIGINT或SIGTERM时优雅关闭，timeout为等待请求处理完成的最长时间
+func (e *Engine) RunGraceful(addr string, timeout time.Duration) error {
+	return e.Graceful(func() error {
+		return e.Run(addr)
+	}, timeout)
+}
+
+//在后台执行run启动服务，收到SIGINT或SIGTERM时调用Shutdown，如：
+//engine.Graceful(func() error { return engine.RunTLS(addr, cert, key) }, 10*time.Second)
+func (e *Engine) Graceful(run func() error, timeout time.Duration) error {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- run()
+	}()
+	select {
+	case err := <-errCh: //启动失败，或在其他地方调用了Shutdown
+		return err
+	case sig := <-quit:
+		if e.Logger != nil {
+			e.Logger.Info(fmt.Sprintf("收到信号 %v，开始关闭服务", sig))
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		return err
+	}
+	return <-errCh
+}
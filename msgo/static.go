@@ -0,0 +1,163 @@
+package msgo
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+//静态文件服务配置
+type StaticConfig struct {
+	FS     http.FileSystem //文件系统，embed.FS等io/fs可以使用http.FS转换
+	MaxAge time.Duration   //Cache-Control的max-age，为0时使用no-cache，每次通过ETag/Last-Modified验证
+	Browse bool            //是否允许列出目录，默认不允许
+	Index  string          //目录的默认文件，默认为index.html
+	SPA    bool            //单页应用，文件不存在时返回根目录下的Index
+}
+
+//将目录root注册为prefix下的静态文件
+func (r *routerGroup) Static(prefix, root string) *Route {
+	return r.StaticWithConfig(prefix, StaticConfig{FS: http.Dir(root)})
+}
+
+//将文件系统fs注册为prefix下的静态文件，embed.FS可以使用 http.FS(fs.Sub(embedFS, "dist")) 转换
+func (r *routerGroup) StaticFS(prefix string, fs http.FileSystem) *Route {
+	return r.StaticWithConfig(prefix, StaticConfig{FS: fs})
+}
+
+//注册单个静态文件
+func (r *routerGroup) StaticFile(relativePath, file string) *Route {
+	if strings.ContainsAny(relativePath, ":*") {
+		panic("静态文件的路由不能包含参数")
+	}
+	s := newStaticHandler(StaticConfig{FS: http.Dir(filepath.Dir(file))})
+	name := "/" + filepath.Base(file)
+	return r.Get(relativePath, func(ctx *Context) {
+		s.serve(ctx, name)
+	})
+}
+
+func (r *routerGroup) StaticWithConfig(prefix string, config StaticConfig) *Route {
+	if strings.ContainsAny(prefix, ":*") {
+		panic("静态文件的路由不能包含参数")
+	}
+	s := newStaticHandler(config)
+	return r.Get(joinPaths(prefix, "/**"), func(ctx *Context) {
+		s.serve(ctx, path.Clean("/"+ctx.Param("**")))
+	})
+}
+
+type staticHandler struct {
+	StaticConfig
+	etags sync.Map //没有修改时间的文件(如embed.FS)，缓存根据内容计算的ETag
+}
+
+func newStaticHandler(config StaticConfig) *staticHandler {
+	if config.Index == "" {
+		config.Index = "index.html"
+	}
+	return &staticHandler{StaticConfig: config}
+}
+
+func (s *staticHandler) serve(ctx *Context, name string) {
+	f, err := s.FS.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) && s.SPA && name != "/"+s.Index {
+			s.serve(ctx, "/"+s.Index)
+			return
+		}
+		s.fail(ctx, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		s.fail(ctx, err)
+		return
+	}
+	if info.IsDir() {
+		index := path.Join(name, s.Index)
+		if indexFile, err := s.FS.Open(index); err == nil {
+			indexFile.Close()
+			s.serve(ctx, index)
+			return
+		}
+		switch {
+		case s.Browse:
+			s.browse(ctx, name)
+		case s.SPA && name != "/":
+			s.serve(ctx, "/"+s.Index)
+		default: //默认不允许列出目录
+			ctx.engine.noRoute(ctx)
+		}
+		return
+	}
+	etag, err := s.etag(name, info, f)
+	if err != nil {
+		s.fail(ctx, err)
+		return
+	}
+	header := ctx.W.Header()
+	header.Set("ETag", etag)
+	if s.MaxAge > 0 {
+		header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(s.MaxAge.Seconds())))
+	} else {
+		header.Set("Cache-Control", "no-cache")
+	}
+	http.ServeContent(ctx.W, ctx.R, info.Name(), info.ModTime(), f) //处理If-None-Match、If-Modified-Since和Range
+}
+
+//列出目录，目录的链接是相对路径，请求路径必须以/结尾
+func (s *staticHandler) browse(ctx *Context, name string) {
+	if !strings.HasSuffix(ctx.R.URL.Path, "/") {
+		location := ctx.R.URL.Path + "/"
+		if ctx.R.URL.RawQuery != "" {
+			location += "?" + ctx.R.URL.RawQuery
+		}
+		ctx.Redirect(http.StatusMovedPermanently, location)
+		return
+	}
+	if !strings.HasSuffix(name, "/") { //保留末尾的/，否则http.FileServer会重定向到相对路径
+		name += "/"
+	}
+	ctx.FileFromFS(name, s.FS)
+}
+
+func (s *staticHandler) etag(name string, info os.FileInfo, f http.File) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano()), nil
+	}
+	if etag, ok := s.etags.Load(name); ok {
+		return etag.(string), nil
+	}
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+	s.etags.Store(name, etag)
+	return etag, nil
+}
+
+func (s *staticHandler) fail(ctx *Context, err error) {
+	if os.IsNotExist(err) {
+		ctx.engine.noRoute(ctx)
+		return
+	}
+	if os.IsPermission(err) {
+		ctx.Fail(http.StatusForbidden, "403 Forbidden")
+		return
+	}
+	ctx.Fail(http.StatusInternalServerError, "500 Internal Server Error")
+}
@@ -0,0 +1,205 @@
+package msgo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+//https服务配置，设置ClientCAFile后开启双向认证
+type TLSConfig struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string //用于验证客户端证书的CA证书，可包含多个PEM证书
+	//客户端证书的验证方式，设置了ClientCAFile时默认为tls.RequireAndVerifyClientCert，
+	//可选认证使用tls.VerifyClientCertIfGiven
+	ClientAuth tls.ClientAuthType
+	MinVersion uint16 //默认tls.VersionTLS12
+	//大于0时每隔该时间在握手时检查证书文件，修改过则重新加载，不需要重启服务
+	ReloadInterval time.Duration
+}
+
+//保存当前使用的证书，文件修改后重新加载
+type certReloader struct {
+	engine  *Engine
+	config  TLSConfig
+	mu      sync.RWMutex
+	current *tls.Config
+	modTime time.Time //加载时证书文件中最新的修改时间
+	checked time.Time //上次检查文件的时间
+}
+
+func (c TLSConfig) clientAuth() (tls.ClientAuthType, error) {
+	clientAuth := c.ClientAuth
+	if clientAuth == tls.NoClientCert && c.ClientCAFile != "" {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	if c.ClientCAFile == "" && (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) {
+		return clientAuth, errors.New("msgo: client certificate verification requires ClientCAFile")
+	}
+	return clientAuth, nil
+}
+
+func (c TLSConfig) files() []string {
+	files := []string{c.CertFile, c.KeyFile}
+	if c.ClientCAFile != "" {
+		files = append(files, c.ClientCAFile)
+	}
+	return files
+}
+
+//根据配置生成tls.Config，证书在这里加载一次，错误在启动前返回
+func (e *Engine) NewTLSConfig(config TLSConfig) (*tls.Config, error) {
+	r := &certReloader{engine: e, config: config}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion: r.current.MinVersion,
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &r.get().Certificates[0], nil
+		},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.get(), nil
+		},
+	}, nil
+}
+
+func (r *certReloader) load() error {
+	clientAuth, err := r.config.clientAuth()
+	if err != nil {
+		return err
+	}
+	var modTime time.Time
+	for _, file := range r.config.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   clientAuth,
+		MinVersion:   r.config.MinVersion,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	if r.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("msgo: no certificates found in %s", r.config.ClientCAFile)
+		}
+	}
+	r.mu.Lock()
+	r.current = config
+	r.modTime = modTime
+	r.checked = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) get() *tls.Config {
+	r.mu.RLock()
+	current, modTime, checked := r.current, r.modTime, r.checked
+	r.mu.RUnlock()
+	if r.config.ReloadInterval <= 0 || time.Since(checked) < r.config.ReloadInterval {
+		return current
+	}
+	r.mu.Lock()
+	r.checked = time.Now()
+	r.mu.Unlock()
+	for _, file := range r.config.files() {
+		info, err := os.Stat(file)
+		if err == nil && info.ModTime().After(modTime) {
+			if err := r.load(); err != nil { //加载失败继续使用原来的证书
+				if r.engine.Logger != nil {
+					r.engine.Logger.Error(fmt.Sprintf("重新加载证书失败: %v", err))
+				}
+				return current
+			}
+			return r.get()
+		}
+	}
+	return current
+}
+
+func (e *Engine) RunTLSWithConfig(addr string, config TLSConfig) error {
+	tlsConfig, err := e.NewTLSConfig(config)
+	if err != nil {
+		return err
+	}
+	e.debugPrintRoutes()
+	srv, err := e.newServer(addr)
+	if err != nil {
+		return err
+	}
+	srv.TLSConfig = tlsConfig
+	return serveError(srv.ListenAndServeTLS("", ""))
+}
+
+//双向认证，客户端必须提供由clientCAFile签发的证书
+func (e *Engine) RunMutualTLS(addr, certFile, keyFile, clientCAFile string) error {
+	return e.RunTLSWithConfig(addr, TLSConfig{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: clientCAFile,
+	})
+}
+
+//返回验证通过的客户端证书，未提供证书或证书未经验证时返回nil
+func (c *Context) ClientCert() *x509.Certificate {
+	if c.R.TLS == nil || len(c.R.TLS.VerifiedChains) == 0 || len(c.R.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return c.R.TLS.PeerCertificates[0]
+}
+
+//根据客户端证书认证
+type CertAuth struct {
+	UnAuthHandler func(ctx *Context)
+	//判断证书是否有权限访问，如检查Subject.CommonName或DNSNames，为nil时只要求证书验证通过
+	Allow func(cert *x509.Certificate) bool
+}
+
+func (a *CertAuth) Auth(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) {
+		cert := ctx.ClientCert()
+		if cert == nil {
+			a.unAuth(ctx, http.StatusUnauthorized)
+			return
+		}
+		if a.Allow != nil && !a.Allow(cert) {
+			a.unAuth(ctx, http.StatusForbidden)
+			return
+		}
+		ctx.Set("user", cert.Subject.CommonName)
+		next(ctx)
+	}
+}
+
+func (a *CertAuth) unAuth(ctx *Context, code int) {
+	if a.UnAuthHandler != nil {
+		a.UnAuthHandler(ctx)
+		ctx.Abort()
+	} else {
+		ctx.AbortWithStatus(code)
+	}
+}
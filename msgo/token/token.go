@@ -231,10 +231,11 @@ func (j *JwtHandler) AuthInterceptor(next msgo.HandlerFunc) msgo.HandlerFunc {
 	}
 }
 
-func (j *JwtHandler) AuthErrorHandler(ctx *msgo.Context, err error) {
+func (j *JwtHandler) AuthErrorHandler(ctx *msgo.Context, err error) { //认证失败后中止请求
 	if j.AuthHandler == nil {
-		ctx.W.WriteHeader(http.StatusUnauthorized)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
 	} else {
 		j.AuthHandler(ctx, nil)
+		ctx.Abort()
 	}
 }
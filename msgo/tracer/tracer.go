@@ -85,7 +85,7 @@ func Tracer(serviceName string) msgo.MiddlewareFunc {
 			ctx.R = ctx.R.WithContext(opentracing.ContextWithSpan(ctx.R.Context(), startSpan))
 			next(ctx)
 			// 继续设置 tag
-			ext.HTTPStatusCode.Set(startSpan, uint16(ctx.StatusCode))
+			ext.HTTPStatusCode.Set(startSpan, uint16(ctx.W.Status()))
 		}
 	}
 }
@@ -1,73 +1,394 @@
 package msgo
 
-import "strings"
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
 
-//前缀树
+//路由参数
+type Param struct {
+	Key   string
+	Value string
+}
+
+//路由匹配时记录的参数，按路径中出现的顺序保存
+type Params []Param
+
+func (ps Params) Get(name string) (string, bool) { //获取参数值，第二个返回值表示参数是否存在
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+func (ps Params) ByName(name string) string { //获取参数值，不存在返回空字符串
+	value, _ := ps.Get(name)
+	return value
+}
+
+//节点类型，匹配时按 静态 > :参数(带约束的优先) > * > ** 的优先级依次尝试
+const (
+	staticKind = iota
+	paramKind
+	wildcardKind
+	catchAllKind
+)
+
+//压缩前缀树(radix tree)
+//静态部分按字节压缩公共前缀，:参数、*、** 只能占据一整段路径，作为单独的子节点保存
+//树只在注册路由时修改，匹配时只读，可以被多个请求并发访问
 type treeNode struct {
-	name       string
-	children   []*treeNode
-	routerName string //节点响应路径，不包含路由组的名称
-	isEnd      bool   //判断是否是尾节点
+	path          string         //静态节点为压缩后的路径片段，参数节点为 :name、:name{正则}、:name<类型>、*、**
+	kind          int            //节点类型
+	indices       string         //静态子节点path的首字节，与children一一对应，用于快速查找
+	children      []*treeNode    //静态子节点
+	paramChildren []*treeNode    //:参数 和 * 子节点，按带约束的 :参数、不带约束的 :参数、* 排列
+	catchAll      *treeNode      //** 子节点
+	key           string         //参数名，:id{[0-9]+} -> id，* -> *，** -> **
+	constraint    *regexp.Regexp //参数约束，不满足时尝试其他路由
+	routerName    string         //尾节点对应的路由
+	isEnd         bool           //判断是否是尾节点
+}
+
+//参数类型约束，:id<int> 等价于 :id{-?[0-9]+}
+var paramTypes = map[string]string{
+	"int":   `-?[0-9]+`,
+	"uint":  `[0-9]+`,
+	"float": `-?[0-9]*\.?[0-9]+`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+func newParamNode(segment string, kind int) (*treeNode, error) { //解析参数片段，编译其中的约束
+	node := &treeNode{path: segment, kind: kind, key: segment}
+	if kind != paramKind {
+		return node, nil
+	}
+	name, expr := segment[1:], ""
+	if i := strings.IndexAny(name, "{<"); i >= 0 {
+		name, expr = name[:i], name[i:]
+		switch {
+		case expr[0] == '{' && expr[len(expr)-1] == '}':
+			expr = expr[1 : len(expr)-1]
+		case expr[0] == '<' && expr[len(expr)-1] == '>':
+			typ, ok := paramTypes[expr[1:len(expr)-1]]
+			if !ok {
+				return nil, fmt.Errorf("unknown param type %s", expr)
+			}
+			expr = typ
+		default:
+			return nil, fmt.Errorf("invalid param constraint %s", expr)
+		}
+		if expr == "" {
+			return nil, fmt.Errorf("empty param constraint")
+		}
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, err
+		}
+		node.constraint = re
+	}
+	if name == "" {
+		return nil, fmt.Errorf("param name must not be empty")
+	}
+	node.key = name
+	return node, nil
+}
+
+func (t *treeNode) sameConstraint(other *treeNode) bool {
+	if t.constraint == nil || other.constraint == nil {
+		return t.constraint == other.constraint
+	}
+	return t.constraint.String() == other.constraint.String()
 }
 
-func (t *treeNode) Put(path string) { //添加路由节点
-	strs := strings.Split(path, "/")
-	for index, name := range strs {
-		if index == 0 { //忽略第一个空格
+//路由中的一段，静态片段可以跨越多级路径
+type routeToken struct {
+	text string
+	kind int
+}
+
+func tokenKind(segment string) int {
+	switch {
+	case segment == "**":
+		return catchAllKind
+	case segment == "*":
+		return wildcardKind
+	case strings.HasPrefix(segment, ":"):
+		return paramKind
+	default:
+		return staticKind
+	}
+}
+
+//将路由拆分为静态片段和参数片段，如 /user/:id/info -> [/user/] [:id] [/info]
+func tokenize(path string) ([]routeToken, error) {
+	if path != "" && path[0] != '/' {
+		return nil, fmt.Errorf("route %s: path must begin with '/'", path)
+	}
+	var tokens []routeToken
+	static := 0
+	for i := 0; i < len(path); {
+		if i == 0 || path[i-1] != '/' || (path[i] != ':' && path[i] != '*') {
+			i++
 			continue
 		}
-		children := t.children
-		isMatch := false
-		for _, node := range children {
-			if node.name == name {
-				isMatch = true
-				t = node
-				break
+		end, err := segmentEnd(path, i)
+		if err != nil {
+			return nil, err
+		}
+		segment := path[i:end]
+		kind := tokenKind(segment)
+		switch {
+		case kind == staticKind: //如 *abc，按静态处理
+			i = end
+			continue
+		case kind == catchAllKind && end != len(path):
+			return nil, fmt.Errorf("route %s: ** must be the last segment", path)
+		}
+		if static < i {
+			tokens = append(tokens, routeToken{text: path[static:i], kind: staticKind})
+		}
+		tokens = append(tokens, routeToken{text: segment, kind: kind})
+		i = end
+		static = end
+	}
+	if static < len(path) {
+		tokens = append(tokens, routeToken{text: path[static:], kind: staticKind})
+	}
+	return tokens, nil
+}
+
+func segmentEnd(path string, start int) (int, error) { //参数片段的结束位置，约束中的/不作为分隔符
+	depth := 0
+	for i := start; i < len(path); i++ {
+		switch path[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '/':
+			if depth == 0 {
+				return i, nil
 			}
 		}
-		if !isMatch { //未匹配到生成新node
-			isEnd := false
-			if index == len(strs)-1 {
-				isEnd = true
+	}
+	if depth != 0 {
+		return 0, fmt.Errorf("route %s: unbalanced braces in param constraint", path)
+	}
+	return len(path), nil
+}
+
+func (t *treeNode) Put(path string) error { //添加路由节点，与已注册的路由冲突时返回错误
+	tokens, err := tokenize(path)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		switch token.kind {
+		case staticKind:
+			t = t.insertStatic(token.text)
+		case paramKind, wildcardKind:
+			node, err := newParamNode(token.text, token.kind)
+			if err != nil {
+				return fmt.Errorf("route %s: %v", path, err)
+			}
+			if t, err = t.insertParam(node); err != nil {
+				return fmt.Errorf("route %s: %v", path, err)
+			}
+		case catchAllKind:
+			if t.catchAll == nil {
+				t.catchAll = &treeNode{path: token.text, kind: token.kind, key: token.text}
 			}
-			node := &treeNode{name: name, children: make([]*treeNode, 0), isEnd: isEnd}
-			children = append(children, node)
-			t.children = children
-			t = node
+			t = t.catchAll
 		}
 	}
+	t.isEnd = true
+	t.routerName = path
+	return nil
 }
 
-func (t *treeNode) Get(path string) *treeNode { //返回最后一个匹配的node，未匹配到返回nil
-	strs := strings.Split(path, "/")
-	routerName := ""
-	for index, name := range strs {
-		if index == 0 { //忽略第一个空格
-			continue
+//插入参数节点，返回树中对应的节点
+//同一位置类型和约束都相同的参数只能有一个，否则后注册的路由会被遮蔽
+//不带约束的 :参数 和 * 可以共存，:参数 优先，后续路径不匹配时回溯尝试 *
+func (t *treeNode) insertParam(node *treeNode) (*treeNode, error) {
+	for _, child := range t.paramChildren {
+		if child.path == node.path {
+			return child, nil
 		}
-		children := t.children
-		isMatch := false
-		for _, node := range children {
-			if node.name == name || node.name == "*" || strings.Contains(node.name, ":") {
-				isMatch = true
-				routerName += "/" + node.name
-				node.routerName = routerName
-				t = node
-				if index == len(strs)-1 {
+		if child.kind == node.kind && child.sameConstraint(node) {
+			return nil, fmt.Errorf("segment %s conflicts with existing %s", node.path, child.path)
+		}
+	}
+	i := len(t.paramChildren)
+	for i > 0 && t.paramChildren[i-1].paramOrder() > node.paramOrder() {
+		i--
+	}
+	t.paramChildren = append(t.paramChildren, nil)
+	copy(t.paramChildren[i+1:], t.paramChildren[i:])
+	t.paramChildren[i] = node
+	return node, nil
+}
+
+func (t *treeNode) paramOrder() int { //paramChildren中的顺序：带约束的 :参数、不带约束的 :参数、*
+	switch {
+	case t.kind == wildcardKind:
+		return 2
+	case t.constraint == nil:
+		return 1
+	}
+	return 0
+}
+
+func (t *treeNode) insertStatic(path string) *treeNode { //插入静态片段，必要时拆分已有节点，返回片段末尾对应的节点
+	for path != "" {
+		index := strings.IndexByte(t.indices, path[0])
+		if index < 0 { //没有公共前缀，直接生成新node
+			child := &treeNode{path: path, kind: staticKind}
+			t.indices += path[:1]
+			t.children = append(t.children, child)
+			return child
+		}
+		child := t.children[index]
+		i := longestCommonPrefix(path, child.path)
+		if i < len(child.path) { //拆分子节点，公共前缀作为新的父节点
+			tail := *child
+			tail.path = child.path[i:]
+			*child = treeNode{
+				path:     child.path[:i],
+				kind:     staticKind,
+				indices:  tail.path[:1],
+				children: []*treeNode{&tail},
+			}
+		}
+		t = child
+		path = path[i:]
+	}
+	return t
+}
+
+func longestCommonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+//返回匹配的尾节点及其路由，未匹配到返回nil
+//:name 匹配的值以name为key，* 匹配的值以*为key，** 匹配的剩余路径以**为key追加到params中
+//匹配过程不修改树，params容量足够时不分配内存
+func (t *treeNode) Get(path string, params *Params) (*treeNode, string) {
+	n := len(*params)
+	node := t.getValue(path, params)
+	if node == nil {
+		*params = (*params)[:n]
+		return nil, ""
+	}
+	return node, node.routerName
+}
+
+//t已匹配，path为剩余路径，按优先级匹配子节点，深层匹配失败时回溯尝试下一个候选
+func (t *treeNode) getValue(path string, params *Params) *treeNode {
+	if path == "" && t.isEnd {
+		return t
+	}
+	if path != "" {
+		if index := strings.IndexByte(t.indices, path[0]); index >= 0 {
+			child := t.children[index]
+			if strings.HasPrefix(path, child.path) {
+				if node := child.getValue(path[len(child.path):], params); node != nil {
 					return node
 				}
-				break
 			}
 		}
-		if !isMatch {
-			for _, node := range children {
-				if node.name == "**" { //**用于路由尾部
-					routerName += "/" + node.name
-					node.routerName = routerName
+	}
+	if len(t.paramChildren) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			segment := path[:end]
+			n := len(*params)
+			for _, child := range t.paramChildren {
+				if child.constraint != nil && !child.constraint.MatchString(segment) {
+					continue
+				}
+				*params = append(*params, Param{Key: child.key, Value: segment})
+				if node := child.getValue(path[end:], params); node != nil {
 					return node
 				}
+				*params = (*params)[:n]
 			}
 		}
 	}
+	if t.catchAll != nil && t.catchAll.isEnd { //**用于路由尾部，匹配剩余的全部路径
+		*params = append(*params, Param{Key: t.catchAll.key, Value: path})
+		return t.catchAll
+	}
 	return nil
 }
+
+func countParams(path string) int { //路由中参数的个数，用于预分配Params
+	return strings.Count(path, "/:") + strings.Count(path, "/*")
+}
+
+func (t *treeNode) has(path string) bool { //路径能否匹配到路由
+	var params Params
+	node, _ := t.Get(path, &params)
+	return node != nil
+}
+
+//忽略大小写查找路由，返回树中路由对应的路径，参数部分保留请求中的值
+//fixTrailingSlash为true时同时尝试去掉或加上末尾的/
+func (t *treeNode) findCaseInsensitivePath(path string, fixTrailingSlash bool) (string, bool) {
+	buf, ok := t.findCaseInsensitive(path, make([]byte, 0, len(path)+1), fixTrailingSlash)
+	return string(buf), ok
+}
+
+func (t *treeNode) findCaseInsensitive(path string, buf []byte, fixTrailingSlash bool) ([]byte, bool) {
+	if path == "" && t.isEnd {
+		return buf, true
+	}
+	if path == "/" && t.isEnd && fixTrailingSlash {
+		return buf, true
+	}
+	for _, child := range t.children {
+		n := len(child.path)
+		if len(path) >= n && strings.EqualFold(path[:n], child.path) {
+			if out, ok := child.findCaseInsensitive(path[n:], append(buf, child.path...), fixTrailingSlash); ok {
+				return out, true
+			}
+		}
+		//请求路径缺少末尾的/
+		if fixTrailingSlash && child.isEnd && len(path)+1 == n && child.path[n-1] == '/' && strings.EqualFold(path, child.path[:n-1]) {
+			return append(buf, child.path...), true
+		}
+	}
+	if len(t.paramChildren) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			segment := path[:end]
+			for _, child := range t.paramChildren {
+				if child.constraint != nil && !child.constraint.MatchString(segment) {
+					continue
+				}
+				if out, ok := child.findCaseInsensitive(path[end:], append(buf, segment...), fixTrailingSlash); ok {
+					return out, true
+				}
+			}
+		}
+	}
+	if t.catchAll != nil && t.catchAll.isEnd {
+		return append(buf, path...), true
+	}
+	return nil, false
+}
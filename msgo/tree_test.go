@@ -6,17 +6,264 @@ import (
 )
 
 func TestTreeNode(t *testing.T) { //前缀树测试
-	root := &treeNode{name: "/", children: make([]*treeNode, 0)}
+	root := &treeNode{}
 	root.Put("/user/get/:id")
 	root.Put("/user/create/hello")
 	root.Put("/user/create/aaa")
 	root.Put("/order/get/aaa")
-	node := root.Get("/user/get/1")
-	fmt.Println(node)
-	node = root.Get("/user/create/hello")
-	fmt.Println(node)
-	node = root.Get("/user/create/aaa")
-	fmt.Println(node)
-	node = root.Get("/order/get/aaa")
-	fmt.Println(node)
+	params := make(Params, 0, 1)
+	node, pattern := root.Get("/user/get/1", &params)
+	fmt.Println(node, pattern)
+	node, pattern = root.Get("/user/create/hello", &params)
+	fmt.Println(node, pattern)
+	node, pattern = root.Get("/user/create/aaa", &params)
+	fmt.Println(node, pattern)
+	node, pattern = root.Get("/order/get/aaa", &params)
+	fmt.Println(node, pattern)
+}
+
+func TestTreeNodeParams(t *testing.T) { //路由参数测试
+	root := &treeNode{}
+	root.Put("/user/get/:id")
+	root.Put("/hello/*/get")
+	root.Put("/static/**")
+	var params Params
+	node, _ := root.Get("/user/get/100", &params)
+	if node == nil || params.ByName("id") != "100" {
+		t.Fatalf("/user/get/100 params = %v", params)
+	}
+	params = params[:0]
+	node, _ = root.Get("/hello/world/get", &params)
+	if node == nil || params.ByName("*") != "world" {
+		t.Fatalf("/hello/world/get params = %v", params)
+	}
+	params = params[:0]
+	node, _ = root.Get("/static/css/index.css", &params)
+	if node == nil || params.ByName("**") != "css/index.css" {
+		t.Fatalf("/static/css/index.css params = %v", params)
+	}
+}
+
+func TestTreeNodePriority(t *testing.T) { //静态 > :参数 > * > **，与注册顺序无关
+	root := &treeNode{}
+	root.Put("/user/**")
+	root.Put("/user/:id/info")
+	root.Put("/user/:id")
+	root.Put("/user/new")
+	root.Put("/user/newer")
+	root.Put("/users")
+	root.Put("/file/*/get")
+	root.Put("/file/**")
+	tests := []struct {
+		path    string
+		pattern string
+	}{
+		{"/user/new", "/user/new"},
+		{"/user/newer", "/user/newer"},
+		{"/user/newest", "/user/:id"},
+		{"/users", "/users"},
+		{"/user/100", "/user/:id"},
+		{"/user/100/info", "/user/:id/info"},
+		{"/user/100/orders", "/user/**"}, //回溯到 **
+		{"/user/new/info", "/user/:id/info"},
+		{"/user/", "/user/**"},
+		{"/file/a/get", "/file/*/get"},
+		{"/file/a/b", "/file/**"},
+	}
+	for _, test := range tests {
+		var params Params
+		node, pattern := root.Get(test.path, &params)
+		if node == nil || pattern != test.pattern {
+			t.Errorf("Get(%s) = %s, want %s", test.path, pattern, test.pattern)
+		}
+	}
+	for _, path := range []string{"/user", "/file", "/order"} {
+		var params Params
+		if node, pattern := root.Get(path, &params); node != nil || len(params) != 0 {
+			t.Errorf("Get(%s) = %s %v, want no match", path, pattern, params)
+		}
+	}
+}
+
+func TestTreeNodeConflict(t *testing.T) {
+	root := &treeNode{}
+	if err := root.Put("/a/:id"); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Put("/a/:id/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Put("/a/:name"); err == nil {
+		t.Error("/a/:name should conflict with /a/:id")
+	}
+	if err := root.Put("/a/*/c"); err != nil { //:参数 和 * 可以共存
+		t.Fatal(err)
+	}
+	if err := root.Put("/a/*"); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Put("/a/*/d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Put("/c/*/x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Put("/c/:id<int>/y"); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Put("/c/:id/z"); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Put("/c/*/z"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path, route string
+		params      Params
+	}{
+		{"/a/1", "/a/:id", Params{{"id", "1"}}}, //:参数 优先于 *
+		{"/a/1/b", "/a/:id/b", Params{{"id", "1"}}},
+		{"/a/1/c", "/a/*/c", Params{{"*", "1"}}}, //:id 后续不匹配，回溯到 *
+		{"/a/1/d", "/a/*/d", Params{{"*", "1"}}},
+		{"/c/1/x", "/c/*/x", Params{{"*", "1"}}},
+		{"/c/1/y", "/c/:id<int>/y", Params{{"id", "1"}}},
+		{"/c/a/z", "/c/:id/z", Params{{"id", "a"}}},
+	}
+	for _, c := range cases {
+		var params Params
+		node, route := root.Get(c.path, &params)
+		if node == nil || route != c.route || fmt.Sprint(params) != fmt.Sprint(c.params) {
+			t.Errorf("Get(%s) = %s %v, want %s %v", c.path, route, params, c.route, c.params)
+		}
+	}
+
+	if err := root.Put("/b/**/c"); err == nil {
+		t.Error("** must be the last segment")
+	}
+	if err := root.Put("b"); err == nil {
+		t.Error("route without leading '/' should be rejected")
+	}
+}
+
+func TestTreeNodeGetNoAlloc(t *testing.T) {
+	root := &treeNode{}
+	root.Put("/user/get/:id")
+	root.Put("/static/**")
+	params := make(Params, 0, 1)
+	allocs := testing.AllocsPerRun(100, func() {
+		params = params[:0]
+		root.Get("/user/get/1", &params)
+		params = params[:0]
+		root.Get("/static/css/index.css", &params)
+	})
+	if allocs != 0 {
+		t.Errorf("Get allocs = %v, want 0", allocs)
+	}
+}
+
+var benchPaths = []string{"/user/get/1", "/user/create/hello", "/user/create/aaa", "/order/get/aaa"}
+
+func BenchmarkTreeNodeGet(b *testing.B) { //tree_test.go 中的用例
+	root := &treeNode{}
+	root.Put("/user/get/:id")
+	root.Put("/user/create/hello")
+	root.Put("/user/create/aaa")
+	root.Put("/order/get/aaa")
+	params := make(Params, 0, 1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, path := range benchPaths {
+			params = params[:0]
+			root.Get(path, &params)
+		}
+	}
+}
+
+func largeTree() *treeNode { //模拟较大的路由表，共 50*8 条路由
+	root := &treeNode{}
+	for i := 0; i < 50; i++ {
+		prefix := fmt.Sprintf("/api/resource%d", i)
+		root.Put(prefix)
+		root.Put(prefix + "/:id")
+		root.Put(prefix + "/:id/detail")
+		root.Put(prefix + "/:id/items/:item")
+		root.Put(prefix + "/search")
+		root.Put(prefix + "/export/csv")
+		root.Put(prefix + "/export/xlsx")
+		root.Put(prefix + "/files/**")
+	}
+	return root
+}
+
+func BenchmarkTreeNodeGetLarge(b *testing.B) {
+	root := largeTree()
+	paths := []string{
+		"/api/resource0/search",
+		"/api/resource25/100/detail",
+		"/api/resource49/100/items/7",
+		"/api/resource37/export/xlsx",
+		"/api/resource12/files/a/b/c.txt",
+	}
+	params := make(Params, 0, 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, path := range paths {
+			params = params[:0]
+			root.Get(path, &params)
+		}
+	}
+}
+
+func BenchmarkTreeNodeGetParallel(b *testing.B) { //匹配时只读，可并发访问
+	root := largeTree()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		params := make(Params, 0, 2)
+		for pb.Next() {
+			params = params[:0]
+			root.Get("/api/resource25/100/items/7", &params)
+		}
+	})
+}
+
+func TestTreeNodeConstraint(t *testing.T) { //参数约束，不满足时尝试其他路由
+	root := &treeNode{}
+	for _, path := range []string{"/get/:name", "/get/:id<int>", "/get/:slug{[a-z-]+}/info", "/file/:name{[^/]+\\.txt}"} {
+		if err := root.Put(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		path    string
+		pattern string
+		key     string
+		value   string
+	}{
+		{"/get/100", "/get/:id<int>", "id", "100"},
+		{"/get/abc", "/get/:name", "name", "abc"},
+		{"/get/a-b/info", "/get/:slug{[a-z-]+}/info", "slug", "a-b"},
+		{"/file/a.txt", "/file/:name{[^/]+\\.txt}", "name", "a.txt"},
+	}
+	for _, test := range tests {
+		var params Params
+		node, pattern := root.Get(test.path, &params)
+		if node == nil || pattern != test.pattern || params.ByName(test.key) != test.value {
+			t.Errorf("Get(%s) = %s %v, want %s", test.path, pattern, params, test.pattern)
+		}
+	}
+	var params Params
+	if node, _ := root.Get("/get/A1/info", &params); node != nil {
+		t.Error("/get/A1/info should not match")
+	}
+	for _, path := range []string{"/bad/:id{[0-9}", "/bad/:id<number>", "/bad/:id{}", "/bad/:{[0-9]+}", "/bad/:id{[0-9]+"} {
+		if err := root.Put(path); err == nil {
+			t.Errorf("Put(%s) should fail", path)
+		}
+	}
+	if err := root.Put("/get/:num<int>"); err == nil {
+		t.Error("/get/:num<int> should conflict with /get/:id<int>")
+	}
 }
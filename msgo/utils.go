@@ -1,6 +1,9 @@
 package msgo
 
-import "strings"
+import (
+	"path"
+	"strings"
+)
 
 func SubStringLast(str string, substr string) string { //从某个位置向后截取字符串
 	index := strings.Index(str, substr)
@@ -9,3 +12,31 @@ func SubStringLast(str string, substr string) string { //从某个位置向后
 	}
 	return str[index+len(substr):]
 }
+
+func joinPaths(absolutePath, relativePath string) string { //拼接路由组前缀和路由，保留末尾的/
+	if relativePath == "" {
+		return absolutePath
+	}
+	finalPath := path.Join(absolutePath, relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(finalPath, "/") {
+		return finalPath + "/"
+	}
+	return finalPath
+}
+
+func cleanPath(p string) string { //清理路径中的 . .. 和重复的/，保留末尾的/
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	np := path.Clean(p)
+	if p[len(p)-1] == '/' && np != "/" {
+		if len(p) == len(np)+1 && strings.HasPrefix(p, np) { //已经是干净的路径，避免重新分配
+			return p
+		}
+		return np + "/"
+	}
+	return np
+}
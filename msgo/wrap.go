@@ -0,0 +1,75 @@
+package msgo
+
+import (
+	"context"
+	msLog "github.com/bulon99/msgo/log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type contextKey struct{}
+
+//获取通过WrapH、WrapF、Mount传入标准库处理函数的请求所对应的Context
+func FromRequest(r *http.Request) (*Context, bool) {
+	ctx, ok := r.Context().Value(contextKey{}).(*Context)
+	return ctx, ok
+}
+
+func (c *Context) requestWithContext() *http.Request {
+	return c.R.WithContext(context.WithValue(c.R.Context(), contextKey{}, c))
+}
+
+//将标准库的http.Handler转换为HandlerFunc
+func WrapH(h http.Handler) HandlerFunc {
+	return func(ctx *Context) {
+		h.ServeHTTP(ctx.W, ctx.requestWithContext())
+	}
+}
+
+//将标准库的http.HandlerFunc转换为HandlerFunc
+func WrapF(f http.HandlerFunc) HandlerFunc {
+	return WrapH(f)
+}
+
+//将http.Handler(如第三方的管理页面、另一个msgo.Engine)挂载到prefix下，路由组的中间件对其同样生效
+//转发给h的请求去掉了prefix，如挂载到/admin时，/admin/users转发为/users
+func (r *routerGroup) Mount(prefix string, h http.Handler) {
+	if strings.ContainsAny(prefix, ":*") {
+		panic("挂载的路由不能包含参数")
+	}
+	handlerFunc := func(ctx *Context) {
+		req := ctx.requestWithContext()
+		rest := "/" + ctx.Param("**")
+		u := *req.URL
+		u.Path = rest
+		u.RawPath = ""
+		if req.URL.RawPath != "" { //保留转义后的路径
+			u.RawPath = (&url.URL{Path: rest}).EscapedPath()
+		}
+		req.URL = &u
+		h.ServeHTTP(ctx.W, req)
+	}
+	if !strings.HasSuffix(joinPaths(r.prefix, prefix), "/") {
+		r.Any(prefix, handlerFunc)
+	}
+	r.Any(joinPaths(prefix, "/**"), handlerFunc)
+}
+
+//将MiddlewareFunc转换为标准库风格的中间件，可以用在其他基于net/http的框架中
+//中间件中的Context只有W、R和Logger可用
+func WrapMiddleware(middlewareFunc MiddlewareFunc) func(http.Handler) http.Handler {
+	logger := msLog.Default()
+	return func(next http.Handler) http.Handler {
+		h := chain(func(ctx *Context) {
+			next.ServeHTTP(ctx.W, ctx.R)
+		}, []MiddlewareFunc{middlewareFunc})
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := &Context{R: r, Logger: logger}
+			ctx.writer.reset(w)
+			ctx.W = &ctx.writer
+			h(ctx)
+			ctx.writer.WriteHeaderNow()
+		})
+	}
+}
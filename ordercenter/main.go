@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/afex/hystrix-go/hystrix"
@@ -13,7 +12,9 @@ import (
 	trace "github.com/bulon99/msgo/tracer"
 	"github.com/bulon99/ordercenter/service"
 	"github.com/opentracing/opentracing-go/ext"
+	"log"
 	"net/http"
+	"time"
 )
 
 func main() {
@@ -89,10 +90,10 @@ func main() {
 	defer grpcClient.Conn.Close()
 	goodsApiClient := api.NewGoodsApiClient(grpcClient.Conn)
 	group.Get("/findGrpc", func(ctx *msgo.Context) {
-		//goodsResponse, _ := goodsApiClient.Find(context.Background(), &api.GoodsRequest{}) //本地调用
+		//goodsResponse, _ := goodsApiClient.Find(ctx, &api.GoodsRequest{}) //本地调用，客户端断开连接时取消调用
 		//ctx.JSON(http.StatusOK, goodsResponse)
 		_ = hystrix.Do("mycommand", func() error { //hystrix熔断
-			goodsResponse, err := goodsApiClient.Find(context.Background(), &api.GoodsRequest{}) //本地调用
+			goodsResponse, err := goodsApiClient.Find(ctx, &api.GoodsRequest{}) //本地调用，客户端断开连接时取消调用
 			if err != nil {
 				return err
 			}
@@ -112,11 +113,13 @@ func main() {
 	defer grpcClient1.Conn.Close()
 	goodsApiClient1 := api.NewGoodsApiClient(grpcClient1.Conn)
 	group.Get("/find_Trace", func(ctx *msgo.Context) {
-		goodsResponse, _ := goodsApiClient1.Find(context.Background(), &api.GoodsRequest{}) //本地调用
+		goodsResponse, _ := goodsApiClient1.Find(ctx, &api.GoodsRequest{}) //本地调用，客户端断开连接时取消调用
 		ctx.JSON(http.StatusOK, goodsResponse)
 	})
 
-	engine.Run("localhost:9003")
+	if err := engine.RunGraceful("localhost:9003", 10*time.Second); err != nil {
+		log.Println(err)
+	}
 }
 
 //namingClient, err := register.CreateNacosClient() //从nacos获取goods服务地址